@@ -0,0 +1,182 @@
+// Command chirpy-admin manages roles and webhook deliveries from the
+// server's shell, for example to bootstrap the first admin:
+//
+//	chirpy-admin grant-role alice@example.com admin
+//
+// or to apply a stored Polka delivery again after fixing a bug:
+//
+//	chirpy-admin replay-webhook 5b4f0c8e-... --force
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/service"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage:
+  chirpy-admin grant-role <email> <role>
+  chirpy-admin revoke-role <email> <role>
+  chirpy-admin roles <email>
+  chirpy-admin webhooks [status] [--cursor <cursor>]
+  chirpy-admin webhook <delivery id>
+  chirpy-admin replay-webhook <delivery id> [--force]`
+
+func main() {
+	godotenv.Load()
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	queries := database.New(db)
+	svc := service.New(queries, service.Config{
+		TokenSecret:   os.Getenv("TOKEN_SECRET"),
+		PolkaWebhooks: newPolkaWebhooks(),
+	})
+	ctx := context.Background()
+
+	args := os.Args[2:]
+	switch {
+	case os.Args[1] == "grant-role" && len(args) == 2:
+		err = svc.GrantRole(ctx, lookupUser(ctx, queries, args[0]).ID, args[1])
+	case os.Args[1] == "revoke-role" && len(args) == 2:
+		err = svc.RevokeRole(ctx, lookupUser(ctx, queries, args[0]).ID, args[1])
+	case os.Args[1] == "roles" && len(args) == 1:
+		var roles []string
+		roles, err = queries.GetUserRoles(ctx, lookupUser(ctx, queries, args[0]).ID)
+		if err == nil {
+			fmt.Println(strings.Join(append([]string{auth.RoleUser}, roles...), " "))
+		}
+	case os.Args[1] == "webhooks" && len(args) <= 3:
+		var page service.WebhookDeliveryPage
+		page, err = svc.ListWebhookDeliveries(ctx, parseWebhooksArgs(args))
+		for _, delivery := range page.Deliveries {
+			fmt.Printf("%s  %s  %-9s  %s  %s\n", delivery.ID, delivery.ReceivedAt.Format(time.RFC3339),
+				delivery.Status, delivery.EventType, delivery.EventID)
+		}
+		if page.NextCursor != "" {
+			fmt.Printf("More deliveries: --cursor %s\n", page.NextCursor)
+		}
+	case os.Args[1] == "webhook" && len(args) == 1:
+		var delivery database.WebhookDelivery
+		delivery, err = svc.GetWebhookDelivery(ctx, parseDeliveryID(args[0]))
+		if err == nil {
+			printDelivery(delivery)
+		}
+	case os.Args[1] == "replay-webhook" && (len(args) == 1 || len(args) == 2 && args[1] == "--force"):
+		var delivery database.WebhookDelivery
+		delivery, err = svc.ReplayWebhookDelivery(ctx, parseDeliveryID(args[0]), len(args) == 2)
+		if err == nil {
+			printDelivery(delivery)
+		}
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+// The server's verifier, so replays accept the same signatures it did
+func newPolkaWebhooks() auth.WebhookVerifier {
+	secrets := os.Getenv("POLKA_WEBHOOK_SECRETS")
+	if secrets == "" {
+		secrets = os.Getenv("POLKA_KEY")
+	}
+
+	verifier := auth.WebhookVerifier{Secrets: auth.WebhookSecrets(secrets)}
+	if value := os.Getenv("POLKA_SIGNATURE_TOLERANCE"); value != "" {
+		tolerance, err := time.ParseDuration(value)
+		if err != nil || tolerance <= 0 {
+			log.Fatalf("Error parsing POLKA_SIGNATURE_TOLERANCE: must be a positive duration such as 15m")
+		}
+		verifier.Tolerance = tolerance
+	}
+	return verifier
+}
+
+func lookupUser(ctx context.Context, queries *database.Queries, email string) database.User {
+	user, err := queries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Fatalf("No user with email %s", email)
+	}
+	if err != nil {
+		log.Fatalf("Error getting user: %s", err)
+	}
+	return user
+}
+
+func parseDeliveryID(s string) uuid.UUID {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		log.Fatalf("Invalid delivery id %s: %s", s, err)
+	}
+	return id
+}
+
+func printDelivery(delivery database.WebhookDelivery) {
+	fmt.Printf("id:          %s\n", delivery.ID)
+	fmt.Printf("received at: %s\n", delivery.ReceivedAt.Format(time.RFC3339))
+	fmt.Printf("status:      %s\n", delivery.Status)
+	fmt.Printf("verified:    %t\n", delivery.Verified)
+	fmt.Printf("event:       %s %s\n", delivery.EventType, delivery.EventID)
+	if delivery.Error != "" {
+		fmt.Printf("error:       %s\n", delivery.Error)
+	}
+	if delivery.HandledAt.Valid {
+		fmt.Printf("handled at:  %s\n", delivery.HandledAt.Time.Format(time.RFC3339))
+	}
+	fmt.Printf("replays:     %d\n", delivery.Replays)
+
+	var header map[string][]string
+	if json.Unmarshal(delivery.Headers, &header) == nil {
+		fmt.Println()
+		names := make([]string, 0, len(header))
+		for name := range header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s: %s\n", name, strings.Join(header[name], ", "))
+		}
+	}
+	fmt.Printf("\n%s\n", delivery.Body)
+}
+
+// Arguments of the webhooks command, an optional status then an optional
+// --cursor from the previous page
+func parseWebhooksArgs(args []string) service.WebhookDeliveryFilter {
+	filter := service.WebhookDeliveryFilter{}
+	if len(args) > 0 && args[0] != "--cursor" {
+		filter.Status = args[0]
+		args = args[1:]
+	}
+	if len(args) == 2 && args[0] == "--cursor" {
+		filter.Cursor = args[1]
+	} else if len(args) != 0 {
+		log.Fatal(usage)
+	}
+	return filter
+}
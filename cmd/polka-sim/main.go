@@ -0,0 +1,301 @@
+// Command polka-sim sends correctly signed Polka webhook events to a running
+// server, to exercise the Chirpy Red flow without the real provider:
+//
+//	polka-sim upgrade 3f1c9a52-...
+//	polka-sim -url https://staging.example.com/api/polka/webhooks lifecycle 3f1c9a52-...
+//
+// Events are signed with the first of POLKA_WEBHOOK_SECRETS, or POLKA_KEY,
+// so the server must share the same environment. Every delivery shows up
+// under /admin/webhooks with its outcome.
+//
+// A scenario's events are created a minute apart, the last one a minute
+// before -at. The server ignores events older than the last one it applied
+// to the subscription, so pass a later -at to run a scenario again within
+// minutes of the last run.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"main/internal/auth"
+	"main/internal/service"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+const defaultURL = "http://localhost:8080/api/polka/webhooks"
+
+// Matches the period the server assumes when Polka omits one
+const period = 30 * 24 * time.Hour
+
+type polkaEvent struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      eventData `json:"data"`
+}
+
+type eventData struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	SubscriptionID   string     `json:"subscription_id"`
+	Plan             string     `json:"plan"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+}
+
+// One request to the server and the response it should get
+type delivery struct {
+	event polkaEvent
+	note  string
+	// Signs with the configured secret when empty
+	secret string
+	// Offset of the signature timestamp from the time of sending
+	signedAt time.Duration
+	want     int
+}
+
+type simulator struct {
+	url            string
+	secret         string
+	client         *http.Client
+	userID         uuid.UUID
+	subscriptionID string
+	plan           string
+	// created_at of the next event, each event is a minute after the last
+	clock time.Time
+}
+
+var scenarios = map[string]struct {
+	description string
+	deliveries  func(s *simulator) []delivery
+}{
+	"upgrade": {"user.upgraded", func(s *simulator) []delivery {
+		return []delivery{s.deliver(s.event(service.PolkaUserUpgraded), "subscription becomes active")}
+	}},
+	"renew": {"user.renewed", func(s *simulator) []delivery {
+		return []delivery{s.deliver(s.event(service.PolkaUserRenewed), "period end moves 30 days out")}
+	}},
+	"payment-failed": {"user.payment_failed", func(s *simulator) []delivery {
+		return []delivery{s.deliver(s.event(service.PolkaPaymentFailed), "past due, Red kept until the period ends")}
+	}},
+	"cancel": {"user.cancelled", func(s *simulator) []delivery {
+		return []delivery{s.deliver(s.event(service.PolkaUserCancelled), "cancelled, Red kept until the period ends")}
+	}},
+	"downgrade": {"user.downgraded", func(s *simulator) []delivery {
+		return []delivery{s.deliver(s.event(service.PolkaUserDowngraded), "expired, Red removed at once")}
+	}},
+	"lifecycle": {"upgrade, renewal, failed payment, renewal and cancellation", func(s *simulator) []delivery {
+		return []delivery{
+			s.deliver(s.event(service.PolkaUserUpgraded), "subscription becomes active"),
+			s.deliver(s.event(service.PolkaUserRenewed), "period end moves 30 days out"),
+			s.deliver(s.event(service.PolkaPaymentFailed), "past due"),
+			s.deliver(s.event(service.PolkaUserRenewed), "active again"),
+			s.deliver(s.event(service.PolkaUserCancelled), "cancelled, Red kept until the period ends"),
+		}
+	}},
+	"duplicate": {"the same upgrade delivered twice", func(s *simulator) []delivery {
+		upgraded := s.event(service.PolkaUserUpgraded)
+		return []delivery{
+			s.deliver(upgraded, "subscription becomes active"),
+			s.deliver(upgraded, "acknowledged and recorded as a duplicate"),
+		}
+	}},
+	"out-of-order": {"a cancellation delivered before the older renewal", func(s *simulator) []delivery {
+		upgraded := s.event(service.PolkaUserUpgraded)
+		renewed := s.event(service.PolkaUserRenewed)
+		cancelled := s.event(service.PolkaUserCancelled)
+		return []delivery{
+			s.deliver(upgraded, "subscription becomes active"),
+			s.deliver(cancelled, "cancelled"),
+			s.deliver(renewed, "older than the cancellation, ignored"),
+		}
+	}},
+	"bad-signature": {"upgrades with a wrong secret and an expired signature", func(s *simulator) []delivery {
+		forged := s.deliver(s.event(service.PolkaUserUpgraded), "wrong secret, rejected")
+		forged.secret = "not-" + s.secret
+		forged.want = http.StatusUnauthorized
+		expired := s.deliver(s.event(service.PolkaUserUpgraded), "signed an hour ago, rejected")
+		expired.signedAt = -time.Hour
+		expired.want = http.StatusUnauthorized
+		return []delivery{forged, expired}
+	}},
+}
+
+func main() {
+	godotenv.Load()
+	log.SetFlags(0)
+
+	secrets := os.Getenv("POLKA_WEBHOOK_SECRETS")
+	if secrets == "" {
+		secrets = os.Getenv("POLKA_KEY")
+	}
+	defaultSecret := ""
+	if list := auth.WebhookSecrets(secrets); len(list) > 0 {
+		defaultSecret = list[0]
+	}
+
+	url := flag.String("url", defaultURL, "webhook endpoint of the server")
+	secret := flag.String("secret", defaultSecret, "signing secret, defaults to the first of POLKA_WEBHOOK_SECRETS or POLKA_KEY")
+	plan := flag.String("plan", "red_monthly", "plan sent with every event")
+	subscriptionID := flag.String("subscription", "", "Polka subscription ID, random when empty")
+	at := flag.String("at", "", "RFC 3339 time the scenario's events lead up to, defaults to now")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+	scenario, ok := scenarios[flag.Arg(0)]
+	if !ok {
+		log.Printf("Unknown scenario %s", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	userID, err := uuid.Parse(flag.Arg(1))
+	if err != nil {
+		log.Fatalf("Invalid user id %s: %s", flag.Arg(1), err)
+	}
+	if *secret == "" {
+		log.Fatal("No signing secret, set POLKA_WEBHOOK_SECRETS or pass -secret")
+	}
+	end := time.Now().UTC().Truncate(time.Second)
+	if *at != "" {
+		end, err = time.Parse(time.RFC3339, *at)
+		if err != nil {
+			log.Fatalf("Invalid -at time %s: %s", *at, err)
+		}
+	}
+
+	sim := &simulator{
+		url:            *url,
+		secret:         *secret,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		userID:         userID,
+		subscriptionID: *subscriptionID,
+		plan:           *plan,
+		clock:          end,
+	}
+	if sim.subscriptionID == "" {
+		sim.subscriptionID = "sub_" + randomID()
+	}
+
+	// Events in the future would make the server ignore the next run's
+	deliveries := scenario.deliveries(sim)
+	endEventsAt(deliveries, sim.clock, end)
+
+	failed := 0
+	for _, d := range deliveries {
+		if err := sim.send(d); err != nil {
+			log.Printf("  %s", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of the deliveries did not get the expected response", failed)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("usage: polka-sim [flags] <scenario> <user id>\n\nscenarios:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-15s %s\n", name, scenarios[name].description)
+	}
+	b.WriteString("\nflags:\n")
+	log.Print(b.String())
+	flag.PrintDefaults()
+}
+
+// A new event for the simulated user, created a minute after the previous one
+func (s *simulator) event(eventType string) polkaEvent {
+	event := polkaEvent{
+		ID:        "evt_" + randomID(),
+		Event:     eventType,
+		CreatedAt: s.clock,
+		Data: eventData{
+			UserID:         s.userID,
+			SubscriptionID: s.subscriptionID,
+			Plan:           s.plan,
+		},
+	}
+	if eventType == service.PolkaUserUpgraded || eventType == service.PolkaUserRenewed {
+		periodEnd := s.clock.Add(period)
+		event.Data.CurrentPeriodEnd = &periodEnd
+	}
+	s.clock = s.clock.Add(time.Minute)
+	return event
+}
+
+// Move the scenario's events back so the last was created a minute before at
+func endEventsAt(deliveries []delivery, clock, at time.Time) {
+	shift := clock.Sub(at)
+	for i := range deliveries {
+		event := &deliveries[i].event
+		event.CreatedAt = event.CreatedAt.Add(-shift)
+		if event.Data.CurrentPeriodEnd != nil {
+			periodEnd := event.Data.CurrentPeriodEnd.Add(-shift)
+			event.Data.CurrentPeriodEnd = &periodEnd
+		}
+	}
+}
+
+func (s *simulator) deliver(event polkaEvent, note string) delivery {
+	return delivery{event: event, note: note, want: http.StatusNoContent}
+}
+
+func (s *simulator) send(d delivery) error {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		return err
+	}
+
+	secret := d.secret
+	if secret == "" {
+		secret = s.secret
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(service.PolkaSignatureHeader, auth.SignWebhook(secret, time.Now().Add(d.signedAt), body))
+
+	log.Printf("%-19s %s  %s", d.event.Event, d.event.ID, d.note)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	log.Printf("  %s", resp.Status)
+	if resp.StatusCode != d.want {
+		return fmt.Errorf("expected %d %s", d.want, http.StatusText(d.want))
+	}
+	return nil
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -5,9 +5,26 @@ go 1.24.2
 require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/google/uuid v1.6.0
+	github.com/graph-gophers/graphql-go v1.5.0
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.38.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+require (
+	github.com/coreos/go-oidc/v3 v3.12.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/pquerna/otp v1.4.0
+	golang.org/x/oauth2 v0.27.0
+	google.golang.org/grpc v1.71.0
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
+	github.com/go-jose/go-jose/v4 v4.0.2 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
+)
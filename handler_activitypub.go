@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"main/internal/activitypub"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/service"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const maxInboxBytes = 1 << 20
+
+func (cfg *apiConfig) actorURL(handle string) string {
+	return fmt.Sprintf("%s/users/%s", cfg.baseURL, handle)
+}
+
+func (cfg *apiConfig) noteURL(handle string, chirpID uuid.UUID) string {
+	return fmt.Sprintf("%s/users/%s/chirps/%s", cfg.baseURL, handle, chirpID)
+}
+
+func (cfg *apiConfig) host() string {
+	parsed, err := url.Parse(cfg.baseURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+// Get the user's actor keys, generating them on first use
+func (cfg *apiConfig) actorKey(ctx context.Context, userID uuid.UUID) (database.ActorKey, error) {
+	key, err := cfg.queries.GetActorKey(ctx, userID)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return key, err
+	}
+
+	privatePEM, publicPEM, err := activitypub.GenerateKeyPair()
+	if err != nil {
+		return key, err
+	}
+
+	key, err = cfg.queries.CreateActorKey(ctx, database.CreateActorKeyParams{
+		UserID:        userID,
+		PublicKeyPem:  publicPEM,
+		PrivateKeyPem: privatePEM,
+	})
+	if err != nil {
+		// Another request may have created the key first
+		return cfg.queries.GetActorKey(ctx, userID)
+	}
+
+	return key, nil
+}
+
+func (cfg *apiConfig) actorSigner(ctx context.Context, user database.User) (activitypub.Signer, error) {
+	key, err := cfg.actorKey(ctx, user.ID)
+	if err != nil {
+		return activitypub.Signer{}, err
+	}
+
+	privateKey, err := activitypub.ParsePrivateKey(key.PrivateKeyPem)
+	if err != nil {
+		return activitypub.Signer{}, err
+	}
+
+	return activitypub.Signer{
+		KeyID: cfg.actorURL(user.Handle.String) + "#main-key",
+		Key:   privateKey,
+	}, nil
+}
+
+func (cfg *apiConfig) userByHandle(ctx context.Context, handle string) (database.User, error) {
+	return cfg.queries.GetUserByHandle(ctx, sql.NullString{String: strings.ToLower(handle), Valid: true})
+}
+
+// Fetch a remote actor and refresh the local cache. With a keyID the
+// document must publish that key. The cached key only changes for a
+// document that passes activitypub.CheckActor.
+func (cfg *apiConfig) cacheRemoteActor(ctx context.Context, actorURL, keyID string, signer *activitypub.Signer) (database.RemoteActor, error) {
+	actor, err := cfg.federation.FetchActor(ctx, actorURL, signer)
+	if err != nil {
+		return database.RemoteActor{}, err
+	}
+	err = activitypub.CheckActor(actor, actorURL, keyID)
+	if err != nil {
+		return database.RemoteActor{}, err
+	}
+
+	sharedInbox := sql.NullString{}
+	if actor.Endpoints != nil && actor.Endpoints.SharedInbox != "" {
+		sharedInbox = sql.NullString{String: actor.Endpoints.SharedInbox, Valid: true}
+	}
+
+	return cfg.queries.UpsertRemoteActor(ctx, database.UpsertRemoteActorParams{
+		ID:                actor.ID,
+		PreferredUsername: actor.PreferredUsername,
+		Inbox:             actor.Inbox,
+		SharedInbox:       sharedInbox,
+		PublicKeyID:       actor.PublicKey.ID,
+		PublicKeyPem:      actor.PublicKey.PublicKeyPem,
+	})
+}
+
+func writeActivityJSON(w http.ResponseWriter, contentType string, v interface{}) {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerWebFinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+
+	handle := ""
+	if account, ok := strings.CutPrefix(resource, "acct:"); ok {
+		name, host, _ := strings.Cut(account, "@")
+		if host != cfg.host() {
+			w.WriteHeader(404)
+			return
+		}
+		handle = name
+	} else if name, ok := strings.CutPrefix(resource, cfg.baseURL+"/users/"); ok {
+		handle = name
+	}
+
+	if handle == "" {
+		w.WriteHeader(400)
+		return
+	}
+
+	user, err := cfg.userByHandle(r.Context(), handle)
+	if err != nil {
+		log.Printf("Error getting user for webfinger: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	actorURL := cfg.actorURL(user.Handle.String)
+	writeActivityJSON(w, "application/jrd+json", activitypub.WebFinger{
+		Subject: fmt.Sprintf("acct:%s@%s", user.Handle.String, cfg.host()),
+		Aliases: []string{actorURL},
+		Links: []activitypub.WebFingerLink{
+			{Rel: "self", Type: activitypub.ContentType, Href: actorURL},
+			{Rel: "http://schemas.google.com/g/2010#updates-from", Type: "application/atom+xml", Href: actorURL + "/feed.atom"},
+		},
+	})
+}
+
+func (cfg *apiConfig) handlerActor(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		log.Printf("Error getting actor: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	key, err := cfg.actorKey(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error getting actor key: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	actorURL := cfg.actorURL(user.Handle.String)
+	writeActivityJSON(w, activitypub.ContentType, activitypub.Actor{
+		Context:           []string{activitypub.ActivityStreamsNS, activitypub.SecurityNS},
+		ID:                actorURL,
+		Type:              "Person",
+		PreferredUsername: user.Handle.String,
+		Name:              user.Handle.String,
+		URL:               actorURL + "/feed.atom",
+		Inbox:             actorURL + "/inbox",
+		Outbox:            actorURL + "/outbox",
+		Followers:         actorURL + "/followers",
+		PublicKey: activitypub.PublicKey{
+			ID:           actorURL + "#main-key",
+			Owner:        actorURL,
+			PublicKeyPem: key.PublicKeyPem,
+		},
+	})
+}
+
+func (cfg *apiConfig) chirpNote(handle string, chirp database.Chirp) activitypub.Note {
+	actorURL := cfg.actorURL(handle)
+	return activitypub.Note{
+		ID:           cfg.noteURL(handle, chirp.ID),
+		Type:         "Note",
+		AttributedTo: actorURL,
+		Content:      "<p>" + html.EscapeString(chirp.Body) + "</p>",
+		Published:    chirp.CreatedAt.UTC().Format(time.RFC3339),
+		URL:          fmt.Sprintf("%s/api/chirps/%s", cfg.baseURL, chirp.ID),
+		To:           []string{activitypub.PublicCollection},
+		Cc:           []string{actorURL + "/followers"},
+	}
+}
+
+func (cfg *apiConfig) handlerOutbox(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		log.Printf("Error getting actor: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	chirps, err := cfg.queries.GetRecentUserChirps(r.Context(), database.GetRecentUserChirpsParams{
+		UserID: user.ID,
+		Limit:  defaultFeedEntries,
+	})
+	if err != nil {
+		log.Printf("Error getting chirps: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	actorURL := cfg.actorURL(user.Handle.String)
+	items := make([]interface{}, len(chirps))
+	for i, chirp := range chirps {
+		note := cfg.chirpNote(user.Handle.String, chirp)
+		activity, err := activitypub.NewActivity(note.ID+"#create", "Create", actorURL, note)
+		if err != nil {
+			log.Printf("Error building activity: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+		activity.Context = nil
+		activity.Published = note.Published
+		activity.To = note.To
+		activity.Cc = note.Cc
+		items[i] = activity
+	}
+
+	writeActivityJSON(w, activitypub.ContentType, activitypub.OrderedCollection{
+		Context:      activitypub.ActivityStreamsNS,
+		ID:           actorURL + "/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   len(items),
+		OrderedItems: items,
+	})
+}
+
+func (cfg *apiConfig) handlerFollowers(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		log.Printf("Error getting actor: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	followerIDs, err := cfg.queries.GetFollowerIDs(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error getting followers: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	items := make([]interface{}, len(followerIDs))
+	for i, id := range followerIDs {
+		items[i] = id
+	}
+
+	writeActivityJSON(w, activitypub.ContentType, activitypub.OrderedCollection{
+		Context:      activitypub.ActivityStreamsNS,
+		ID:           cfg.actorURL(user.Handle.String) + "/followers",
+		Type:         "OrderedCollection",
+		TotalItems:   len(items),
+		OrderedItems: items,
+	})
+}
+
+func (cfg *apiConfig) handlerNote(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		log.Printf("Error getting actor: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("Error converting string to uuid: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	chirp, err := cfg.queries.GetChirpByID(r.Context(), chirpID)
+	if err != nil || chirp.UserID != user.ID {
+		w.WriteHeader(404)
+		return
+	}
+
+	note := cfg.chirpNote(user.Handle.String, chirp)
+	note.Context = activitypub.ActivityStreamsNS
+	writeActivityJSON(w, activitypub.ContentType, note)
+}
+
+// Verify the inbox request signature and return the sending actor
+func (cfg *apiConfig) verifyInboxRequest(r *http.Request, body []byte, signer activitypub.Signer) (database.RemoteActor, error) {
+	keyID, err := activitypub.SignatureKeyID(r)
+	if err != nil {
+		return database.RemoteActor{}, err
+	}
+
+	actor, err := cfg.queries.GetRemoteActorByKeyID(r.Context(), keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		actorURL, _, _ := strings.Cut(keyID, "#")
+		actor, err = cfg.cacheRemoteActor(r.Context(), actorURL, keyID, &signer)
+	}
+	if err != nil {
+		return database.RemoteActor{}, err
+	}
+
+	publicKey, err := activitypub.ParsePublicKey(actor.PublicKeyPem)
+	if err != nil {
+		return database.RemoteActor{}, err
+	}
+
+	if err := activitypub.Verify(r, body, publicKey); err != nil {
+		// The remote may have rotated its key since we cached it
+		actor, err = cfg.cacheRemoteActor(r.Context(), actor.ID, keyID, &signer)
+		if err != nil {
+			return database.RemoteActor{}, err
+		}
+		publicKey, err = activitypub.ParsePublicKey(actor.PublicKeyPem)
+		if err != nil {
+			return database.RemoteActor{}, err
+		}
+		if err := activitypub.Verify(r, body, publicKey); err != nil {
+			return database.RemoteActor{}, err
+		}
+	}
+
+	return actor, nil
+}
+
+func (cfg *apiConfig) handlerInbox(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		log.Printf("Error getting actor: %s", err)
+		w.WriteHeader(404)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInboxBytes))
+	if err != nil {
+		log.Printf("Error reading inbox body: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	activity := activitypub.Activity{}
+	err = json.Unmarshal(body, &activity)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	signer, err := cfg.actorSigner(r.Context(), user)
+	if err != nil {
+		log.Printf("Error loading actor key: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	remote, err := cfg.verifyInboxRequest(r, body, signer)
+	if err != nil {
+		log.Printf("Error verifying inbox signature: %s", err)
+		w.WriteHeader(401)
+		return
+	}
+
+	if activity.Actor != remote.ID {
+		log.Printf("Activity actor %s does not match signer %s", activity.Actor, remote.ID)
+		w.WriteHeader(403)
+		return
+	}
+
+	status := cfg.processActivity(r.Context(), user, remote, activity, signer)
+	w.WriteHeader(status)
+}
+
+func (cfg *apiConfig) processActivity(ctx context.Context, user database.User, remote database.RemoteActor, activity activitypub.Activity, signer activitypub.Signer) int {
+	actorURL := cfg.actorURL(user.Handle.String)
+
+	switch activity.Type {
+	case "Follow":
+		objectID, err := activity.ObjectID()
+		if err != nil || objectID != actorURL {
+			return 400
+		}
+
+		err = cfg.queries.AddFollower(ctx, database.AddFollowerParams{UserID: user.ID, ActorID: remote.ID})
+		if err != nil {
+			log.Printf("Error adding follower: %s", err)
+			return 500
+		}
+
+		accept, err := activitypub.NewActivity(actorURL+"#accepts/"+uuid.NewString(), "Accept", actorURL, activity)
+		if err != nil {
+			log.Printf("Error building accept: %s", err)
+			return 500
+		}
+		cfg.queueDelivery(remote.Inbox, accept, signer)
+
+	case "Undo":
+		inner, err := activity.InnerActivity()
+		if err != nil || inner.Type != "Follow" || inner.Actor != remote.ID {
+			return 202
+		}
+
+		err = cfg.queries.RemoveFollower(ctx, database.RemoveFollowerParams{UserID: user.ID, ActorID: remote.ID})
+		if err != nil {
+			log.Printf("Error removing follower: %s", err)
+			return 500
+		}
+
+	case "Accept":
+		inner, err := activity.InnerActivity()
+		if err != nil || inner.Type != "Follow" || inner.Actor != actorURL {
+			return 202
+		}
+
+		err = cfg.queries.AcceptFollowing(ctx, database.AcceptFollowingParams{UserID: user.ID, ActorID: remote.ID})
+		if err != nil {
+			log.Printf("Error accepting follow: %s", err)
+			return 500
+		}
+
+	case "Create":
+		note, err := activity.Note()
+		if err != nil || note.Type != "Note" || note.AttributedTo != remote.ID {
+			return 202
+		}
+
+		followed, err := cfg.queries.IsActorFollowed(ctx, remote.ID)
+		if err != nil {
+			log.Printf("Error checking follow: %s", err)
+			return 500
+		}
+		if !followed {
+			return 202
+		}
+
+		published, err := time.Parse(time.RFC3339, note.Published)
+		if err != nil {
+			published = time.Now().UTC()
+		}
+
+		err = cfg.queries.CreateRemoteNote(ctx, database.CreateRemoteNoteParams{
+			ID:          note.ID,
+			ActorID:     remote.ID,
+			Content:     note.Content,
+			PublishedAt: published.UTC(),
+		})
+		if err != nil {
+			log.Printf("Error storing remote note: %s", err)
+			return 500
+		}
+
+	case "Delete":
+		objectID, err := activity.ObjectID()
+		if err != nil {
+			return 400
+		}
+
+		if objectID == remote.ID {
+			err = cfg.queries.DeleteRemoteActor(ctx, remote.ID)
+		} else {
+			err = cfg.queries.DeleteRemoteNote(ctx, database.DeleteRemoteNoteParams{ID: objectID, ActorID: remote.ID})
+		}
+		if err != nil {
+			log.Printf("Error applying delete: %s", err)
+			return 500
+		}
+	}
+
+	return 202
+}
+
+// An activity waiting for a delivery worker
+type delivery struct {
+	inbox    string
+	activity activitypub.Activity
+	signer   activitypub.Signer
+}
+
+const (
+	deliveryWorkers   = 8
+	deliveryQueueSize = 1000
+)
+
+// Start the workers that send queued activities to remote inboxes
+func (cfg *apiConfig) startDeliveryWorkers() {
+	cfg.deliveries = make(chan delivery, deliveryQueueSize)
+	for range deliveryWorkers {
+		go func() {
+			for d := range cfg.deliveries {
+				cfg.deliver(d)
+			}
+		}()
+	}
+}
+
+// Queue an activity for delivery, dropping it when the queue is full
+func (cfg *apiConfig) queueDelivery(inbox string, activity activitypub.Activity, signer activitypub.Signer) {
+	select {
+	case cfg.deliveries <- delivery{inbox: inbox, activity: activity, signer: signer}:
+	default:
+		log.Printf("Delivery queue full, dropping %s to %s", activity.Type, inbox)
+	}
+}
+
+func (cfg *apiConfig) deliver(d delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := cfg.federation.Deliver(ctx, d.inbox, d.activity, d.signer)
+	if err != nil {
+		log.Printf("Error delivering %s to %s: %s", d.activity.Type, d.inbox, err)
+	}
+}
+
+// Send a Create or Delete for a chirp to every remote follower of its author
+func (cfg *apiConfig) federateChirp(chirp database.Chirp, activityType string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := cfg.queries.GetUserByID(ctx, chirp.UserID)
+	if err != nil || !user.Handle.Valid {
+		return
+	}
+
+	inboxes, err := cfg.queries.GetFollowerInboxes(ctx, user.ID)
+	if err != nil || len(inboxes) == 0 {
+		return
+	}
+
+	signer, err := cfg.actorSigner(ctx, user)
+	if err != nil {
+		log.Printf("Error loading actor key: %s", err)
+		return
+	}
+
+	actorURL := cfg.actorURL(user.Handle.String)
+	note := cfg.chirpNote(user.Handle.String, chirp)
+
+	var object interface{} = note
+	if activityType == "Delete" {
+		object = map[string]string{"id": note.ID, "type": "Tombstone"}
+	}
+
+	activity, err := activitypub.NewActivity(note.ID+"#"+strings.ToLower(activityType), activityType, actorURL, object)
+	if err != nil {
+		log.Printf("Error building activity: %s", err)
+		return
+	}
+	activity.To = note.To
+	activity.Cc = note.Cc
+
+	for _, inbox := range inboxes {
+		cfg.queueDelivery(inbox, activity, signer)
+	}
+}
+
+// Federate chirps created or deleted through any API, one at a time since
+// the deliveries themselves are queued
+func (cfg *apiConfig) federateEvents(events <-chan service.ChirpEvent) {
+	for event := range events {
+		switch event.Type {
+		case service.ChirpCreated:
+			cfg.federateChirp(event.Chirp, "Create")
+		case service.ChirpDeleted:
+			cfg.federateChirp(event.Chirp, "Delete")
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerFollowRemote(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Account string `json:"account"`
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeFollowsWrite)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	user, err := cfg.queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	if !user.Handle.Valid {
+		log.Print("User needs a handle to follow remote accounts")
+		w.WriteHeader(400)
+		return
+	}
+
+	signer, err := cfg.actorSigner(r.Context(), user)
+	if err != nil {
+		log.Printf("Error loading actor key: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	actorURL := params.Account
+	if !strings.HasPrefix(actorURL, "http://") && !strings.HasPrefix(actorURL, "https://") {
+		actorURL, err = cfg.federation.ResolveAccount(r.Context(), params.Account)
+		if err != nil {
+			log.Printf("Error resolving account: %s", err)
+			w.WriteHeader(404)
+			return
+		}
+	}
+
+	remote, err := cfg.cacheRemoteActor(r.Context(), actorURL, "", &signer)
+	if err != nil {
+		log.Printf("Error fetching remote actor: %s", err)
+		w.WriteHeader(502)
+		return
+	}
+
+	err = cfg.queries.CreateFollowing(r.Context(), database.CreateFollowingParams{UserID: user.ID, ActorID: remote.ID})
+	if err != nil {
+		log.Printf("Error recording follow: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	localActor := cfg.actorURL(user.Handle.String)
+	follow, err := activitypub.NewActivity(localActor+"#follows/"+uuid.NewString(), "Follow", localActor, remote.ID)
+	if err != nil {
+		log.Printf("Error building follow: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	err = cfg.federation.Deliver(r.Context(), remote.Inbox, follow, signer)
+	if err != nil {
+		log.Printf("Error delivering follow: %s", err)
+		w.WriteHeader(502)
+		return
+	}
+
+	w.WriteHeader(202)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/service"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// Serve the handler only to first-party tokens whose roles grant the permission
+func (cfg *apiConfig) middlewarePermission(permission string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r.Header)
+		if err != nil {
+			log.Printf("Error getting token: %s", err)
+			w.WriteHeader(serviceErrorStatus(err))
+			return
+		}
+
+		claims, err := cfg.service.Authorize(r.Context(), token, auth.ScopeAccount)
+		if err != nil {
+			log.Printf("Error authorizing token: %s", err)
+			writeAuthError(w, err)
+			return
+		}
+
+		err = cfg.service.RequirePermission(r.Context(), claims, permission)
+		if err != nil {
+			log.Printf("Error checking permission: %s", err)
+			w.WriteHeader(serviceErrorStatus(err))
+			return
+		}
+
+		// Admin actions are audited with the caller as the actor
+		ctx := service.WithActor(context.WithValue(r.Context(), claimsContextKey, claims), claims.UserID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Claims of the caller, set by middlewarePermission
+func requestClaims(r *http.Request) auth.Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(auth.Claims)
+	return claims
+}
+
+func (cfg *apiConfig) handlerUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.UnlockLogin(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error unlocking login: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerGrantRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.GrantRole(r.Context(), userID, r.PathValue("role"))
+	if err != nil {
+		log.Printf("Error granting role: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s granted role %s to %s", requestClaims(r).UserID, r.PathValue("role"), userID)
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerRevokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.RevokeRole(r.Context(), userID, r.PathValue("role"))
+	if err != nil {
+		log.Printf("Error revoking role: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s revoked role %s from %s", requestClaims(r).UserID, r.PathValue("role"), userID)
+	w.WriteHeader(204)
+}
+
+type Suspension struct {
+	Reason      string     `json:"reason"`
+	SuspendedAt time.Time  `json:"suspended_at"`
+	Until       *time.Time `json:"until"`
+}
+
+type AdminUser struct {
+	User
+	TwoFactorEnabled bool        `json:"two_factor_enabled"`
+	Suspension       *Suspension `json:"suspension"`
+}
+
+type Subscription struct {
+	Provider         string     `json:"provider"`
+	ProviderRef      string     `json:"provider_ref,omitempty"`
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+type UserActivity struct {
+	ChirpCount     int64      `json:"chirp_count"`
+	FollowerCount  int64      `json:"follower_count"`
+	ActiveSessions int64      `json:"active_sessions"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+}
+
+func adminUserResponse(user database.User) AdminUser {
+	response := AdminUser{
+		User:             userResponse(user),
+		TwoFactorEnabled: user.TotpEnabledAt.Valid,
+	}
+	if user.SuspendedAt.Valid {
+		response.Suspension = &Suspension{
+			Reason:      user.SuspensionReason.String,
+			SuspendedAt: user.SuspendedAt.Time,
+		}
+		if user.SuspendedUntil.Valid {
+			response.Suspension.Until = &user.SuspendedUntil.Time
+		}
+	}
+	return response
+}
+
+func writeAdminUser(w http.ResponseWriter, user database.User) {
+	dat, err := json.Marshal(adminUserResponse(user))
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := queryLimit(query)
+	if err != nil {
+		log.Printf("Error parsing limit: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	page, err := cfg.service.ListUsers(r.Context(), service.UserFilter{
+		Search: query.Get("q"),
+		Cursor: query.Get("cursor"),
+		Limit:  limit,
+	})
+	if err != nil {
+		log.Printf("Error listing users: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type pageData struct {
+		Users      []AdminUser `json:"users"`
+		NextCursor string      `json:"next_cursor,omitempty"`
+	}
+
+	response := pageData{Users: make([]AdminUser, len(page.Users)), NextCursor: page.NextCursor}
+	for i, user := range page.Users {
+		response.Users[i] = adminUserResponse(user)
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	details, err := cfg.service.GetUserDetails(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user details: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type detailsData struct {
+		AdminUser
+		Roles        []string      `json:"roles"`
+		Activity     UserActivity  `json:"activity"`
+		Subscription *Subscription `json:"subscription"`
+	}
+
+	response := detailsData{
+		AdminUser: adminUserResponse(details.User),
+		Roles:     details.Roles,
+		Activity: UserActivity{
+			ChirpCount:     details.Activity.ChirpCount,
+			FollowerCount:  details.Activity.FollowerCount,
+			ActiveSessions: details.Activity.ActiveSessions,
+		},
+	}
+	if details.Activity.LastSeenAt.Valid {
+		response.Activity.LastSeenAt = &details.Activity.LastSeenAt.Time
+	}
+	if sub := details.Subscription; sub != nil {
+		response.Subscription = &Subscription{
+			Provider:    sub.Provider,
+			ProviderRef: sub.ProviderRef,
+			Plan:        sub.Plan,
+			Status:      sub.Status,
+			UpdatedAt:   sub.UpdatedAt,
+		}
+		if sub.CurrentPeriodEnd.Valid {
+			response.Subscription.CurrentPeriodEnd = &sub.CurrentPeriodEnd.Time
+		}
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerSuspendUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason string `json:"reason"`
+		// Omitted to suspend until lifted
+		Until *time.Time `json:"until"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	var until time.Time
+	if params.Until != nil {
+		until = *params.Until
+	}
+
+	user, err := cfg.service.SuspendUser(r.Context(), userID, params.Reason, until)
+	if err != nil {
+		log.Printf("Error suspending user: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s suspended %s", requestClaims(r).UserID, userID)
+	writeAdminUser(w, user)
+}
+
+func (cfg *apiConfig) handlerUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	user, err := cfg.service.UnsuspendUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error unsuspending user: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s lifted the suspension of %s", requestClaims(r).UserID, userID)
+	writeAdminUser(w, user)
+}
+
+func (cfg *apiConfig) handlerForceLogout(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.ForceLogout(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error logging user out: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s logged out %s everywhere", requestClaims(r).UserID, userID)
+	w.WriteHeader(204)
+}
+
+// PUT grants Chirpy Red and DELETE revokes it
+func (cfg *apiConfig) handlerSetChirpyRed(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	enabled := r.Method == http.MethodPut
+	user, err := cfg.service.SetChirpyRed(r.Context(), userID, enabled)
+	if err != nil {
+		log.Printf("Error setting Chirpy Red: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s set Chirpy Red of %s to %t", requestClaims(r).UserID, userID, enabled)
+	writeAdminUser(w, user)
+}
+
+func (cfg *apiConfig) handlerAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("Error parsing user id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.DeleteUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error deleting user: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s deleted %s", requestClaims(r).UserID, userID)
+	w.WriteHeader(204)
+}
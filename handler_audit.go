@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// An event on the caller's own account. Changes made by an operator
+// do not reveal who made them or from where.
+type SecurityEvent struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	EventType string    `json:"event_type"`
+	// you, operator or system
+	Actor     string          `json:"actor"`
+	IP        string          `json:"ip,omitempty"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+type AuditEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	EventType string          `json:"event_type"`
+	ActorID   *uuid.UUID      `json:"actor_id"`
+	TargetID  *uuid.UUID      `json:"target_id"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+func securityEventResponse(event database.AuditEvent, userID uuid.UUID) SecurityEvent {
+	response := SecurityEvent{
+		ID:        event.ID,
+		CreatedAt: event.CreatedAt,
+		EventType: event.EventType,
+		Actor:     "system",
+		Metadata:  event.Metadata,
+	}
+	switch {
+	case event.ActorID.Valid && event.ActorID.UUID == userID:
+		response.Actor = "you"
+		response.IP = event.Ip
+		response.UserAgent = event.UserAgent
+	case event.ActorID.Valid:
+		response.Actor = "operator"
+	}
+	return response
+}
+
+func auditEventResponse(event database.AuditEvent) AuditEvent {
+	response := AuditEvent{
+		ID:        event.ID,
+		CreatedAt: event.CreatedAt,
+		EventType: event.EventType,
+		IP:        event.Ip,
+		UserAgent: event.UserAgent,
+		Metadata:  event.Metadata,
+	}
+	if event.ActorID.Valid {
+		response.ActorID = &event.ActorID.UUID
+	}
+	if event.TargetID.Valid {
+		response.TargetID = &event.TargetID.UUID
+	}
+	return response
+}
+
+// The limit query parameter, zero when absent
+func queryLimit(query url.Values) (int, error) {
+	value := query.Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", value)
+	}
+	return limit, nil
+}
+
+func (cfg *apiConfig) handlerListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	token, err := bearerToken(r.Header)
+	if err != nil {
+		log.Printf("Error getting bearer token: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	claims, err := cfg.service.Authorize(r.Context(), token, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error validating JWT: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	limit, err := queryLimit(r.URL.Query())
+	if err != nil {
+		log.Printf("Error parsing limit: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	page, err := cfg.service.ListSecurityEvents(r.Context(), claims.UserID, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		log.Printf("Error listing security events: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type pageData struct {
+		Events     []SecurityEvent `json:"events"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}
+
+	response := pageData{Events: make([]SecurityEvent, len(page.Events)), NextCursor: page.NextCursor}
+	for i, event := range page.Events {
+		response.Events[i] = securityEventResponse(event, claims.UserID)
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+// Filters of the admin audit query, every one optional
+func auditFilter(query url.Values) (service.AuditFilter, error) {
+	filter := service.AuditFilter{
+		IP:     query.Get("ip"),
+		Cursor: query.Get("cursor"),
+	}
+
+	for _, value := range query["event_type"] {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				filter.EventTypes = append(filter.EventTypes, eventType)
+			}
+		}
+	}
+
+	for name, dest := range map[string]*uuid.UUID{"actor_id": &filter.ActorID, "target_id": &filter.TargetID} {
+		if value := query.Get(name); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*dest = id
+		}
+	}
+
+	for name, dest := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*dest = t
+		}
+	}
+
+	limit, err := queryLimit(query)
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit = limit
+	return filter, nil
+}
+
+func (cfg *apiConfig) handlerListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		log.Printf("Error parsing audit filter: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	page, err := cfg.service.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing audit events: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type pageData struct {
+		Events     []AuditEvent `json:"events"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+
+	response := pageData{Events: make([]AuditEvent, len(page.Events)), NextCursor: page.NextCursor}
+	for i, event := range page.Events {
+		response.Events[i] = auditEventResponse(event)
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
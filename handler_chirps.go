@@ -4,9 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"main/internal/auth"
-	"main/internal/database"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
@@ -28,8 +26,6 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		UserId uuid.UUID `json:"user_id"`
 	}
 
-	header := 200
-
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
@@ -40,17 +36,17 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Token Validation for user
-	token, err := auth.GetBearerToken(r.Header)
+	token, err := bearerToken(r.Header)
 	if err != nil {
 		log.Printf("Error getting bearer token: %s", err)
-		w.WriteHeader(500)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	tokenUserID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	tokenUserID, err := cfg.service.Authenticate(r.Context(), token, auth.ScopeChirpsWrite)
 	if err != nil {
 		log.Printf("Error validating JWT: %s", err)
-		w.WriteHeader(401)
+		writeAuthError(w, err)
 		return
 	}
 
@@ -60,18 +56,10 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if len(params.Body) > 140 {
-		log.Print("Chirp is too long", err)
-		header = 400
-	}
-
-	chirp, err := cfg.queries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   params.Body,
-		UserID: params.UserId,
-	})
+	chirp, err := cfg.service.CreateChirp(r.Context(), params.UserId, params.Body)
 	if err != nil {
 		log.Printf("Error creating chirp: %s", err)
-		w.WriteHeader(500)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
@@ -83,32 +71,28 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(header)
+	w.WriteHeader(200)
 	w.Write(dat)
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 
-	var chirps []database.Chirp
-	var err error
-
 	// Check for queries
 	authorID := r.URL.Query().Get("author_id")
 	chirpOrder := r.URL.Query().Get("sort")
 
+	var author uuid.NullUUID
 	if authorID != "" {
 		parsedAuthorID, err := uuid.Parse(authorID)
 		if err != nil {
 			log.Printf("Error parsing uuid: %s", err)
-			w.WriteHeader(500)
+			w.WriteHeader(400)
 			return
 		}
-		chirps, err = cfg.queries.GetUserChirps(r.Context(), parsedAuthorID)
-
-	} else {
-		chirps, err = cfg.queries.GetChirps(r.Context())
+		author = uuid.NullUUID{UUID: parsedAuthorID, Valid: true}
 	}
 
+	chirps, err := cfg.service.ListChirps(r.Context(), author, chirpOrder == "desc")
 	if err != nil {
 		log.Printf("Error getting chirps: %s", err)
 		w.WriteHeader(500)
@@ -126,13 +110,6 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Sort chirps
-	if chirpOrder == "desc" {
-		sort.Slice(response, func(i, j int) bool { return response[i].CreatedAt.After(response[j].CreatedAt) })
-	} else {
-		sort.Slice(response, func(i, j int) bool { return response[i].CreatedAt.Before(response[j].CreatedAt) })
-	}
-
 	dat, err := json.Marshal(response)
 	if err != nil {
 		log.Printf("Error marshalling json: %s", err)
@@ -154,10 +131,10 @@ func (cfg *apiConfig) handlerGetChirpID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chirp, err := cfg.queries.GetChirpByID(r.Context(), id)
+	chirp, err := cfg.service.GetChirp(r.Context(), id)
 	if err != nil {
 		log.Printf("Error getting chirps: %s", err)
-		w.WriteHeader(500)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 	response := Chirp{
@@ -203,30 +180,17 @@ func (cfg *apiConfig) handlerDeleteChirpID(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	reqUserID, err := cfg.AuthorizeHeader(r.Header)
+	reqUserID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeChirpsWrite)
 	if err != nil {
 		log.Printf("Error authorizing header: %s", err)
-		w.WriteHeader(500)
-		return
-	}
-
-	chirp, err := cfg.queries.GetChirpByID(r.Context(), chirpID)
-	if err != nil {
-		log.Printf("Error getting chirp: %s", err)
-		w.WriteHeader(404)
-		return
-	}
-
-	if chirp.UserID != reqUserID {
-		log.Print("Invalid user")
-		w.WriteHeader(403)
+		writeAuthError(w, err)
 		return
 	}
 
-	err = cfg.queries.DeleteChirpByID(r.Context(), chirp.ID)
+	err = cfg.service.DeleteChirp(r.Context(), reqUserID, chirpID)
 	if err != nil {
 		log.Printf("Error deleting chirp: %v", err)
-		w.WriteHeader(403)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
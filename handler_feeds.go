@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/database"
+	"main/internal/feed"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultFeedEntries = 20
+	maxFeedEntries     = 100
+	feedTitleLength    = 50
+)
+
+var hashtagPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+func (cfg *apiConfig) handlerUserFeed(format feed.Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := feedLimit(r)
+		if err != nil {
+			log.Printf("Error parsing feed limit: %s", err)
+			w.WriteHeader(400)
+			return
+		}
+
+		handle := strings.ToLower(r.PathValue("handle"))
+		user, err := cfg.queries.GetUserByHandle(r.Context(), sql.NullString{String: handle, Valid: true})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				w.WriteHeader(404)
+				return
+			}
+			log.Printf("Error getting user by handle: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+
+		chirps, err := cfg.queries.GetRecentUserChirps(r.Context(), database.GetRecentUserChirpsParams{
+			UserID: user.ID,
+			Limit:  limit,
+		})
+		if err != nil {
+			log.Printf("Error getting chirps: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+
+		userFeed := feed.Feed{
+			ID:          fmt.Sprintf("urn:uuid:%s", user.ID),
+			Title:       fmt.Sprintf("Chirps by @%s", handle),
+			Description: fmt.Sprintf("Latest chirps posted by @%s", handle),
+			Link:        fmt.Sprintf("%s/api/chirps?author_id=%s", cfg.baseURL, user.ID),
+			Self:        fmt.Sprintf("%s/users/%s/feed.%s", cfg.baseURL, handle, format),
+			Author:      handle,
+			Updated:     user.UpdatedAt,
+			Entries:     cfg.feedEntries(chirps, map[string]string{user.ID.String(): handle}),
+		}
+
+		writeFeed(w, r, userFeed, format)
+	}
+}
+
+func (cfg *apiConfig) handlerHashtagFeed(format feed.Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := feedLimit(r)
+		if err != nil {
+			log.Printf("Error parsing feed limit: %s", err)
+			w.WriteHeader(400)
+			return
+		}
+
+		tag := strings.ToLower(r.PathValue("tag"))
+		if !hashtagPattern.MatchString(tag) {
+			log.Printf("Invalid hashtag: %s", tag)
+			w.WriteHeader(400)
+			return
+		}
+
+		chirps, err := cfg.queries.GetRecentChirpsByHashtag(r.Context(), database.GetRecentChirpsByHashtagParams{
+			Tag:        tag,
+			EntryLimit: limit,
+		})
+		if err != nil {
+			log.Printf("Error getting chirps: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+
+		authors, err := cfg.chirpAuthors(r.Context(), chirps)
+		if err != nil {
+			log.Printf("Error getting chirp authors: %s", err)
+			w.WriteHeader(500)
+			return
+		}
+
+		// An empty feed was last updated now, otherwise by its newest chirp
+		updated := time.Now().UTC()
+		if len(chirps) > 0 {
+			updated = chirps[0].UpdatedAt
+			for _, chirp := range chirps {
+				if chirp.UpdatedAt.After(updated) {
+					updated = chirp.UpdatedAt
+				}
+			}
+		}
+
+		tagFeed := feed.Feed{
+			ID:          fmt.Sprintf("%s/hashtags/%s", cfg.baseURL, tag),
+			Title:       fmt.Sprintf("Chirps tagged #%s", tag),
+			Description: fmt.Sprintf("Latest chirps tagged #%s", tag),
+			Link:        fmt.Sprintf("%s/api/chirps", cfg.baseURL),
+			Self:        fmt.Sprintf("%s/hashtags/%s/feed.%s", cfg.baseURL, tag, format),
+			Author:      "Chirpy",
+			Updated:     updated,
+			Entries:     cfg.feedEntries(chirps, authors),
+		}
+
+		writeFeed(w, r, tagFeed, format)
+	}
+}
+
+// Handles of the chirps' authors by user ID, users without a handle are left out
+func (cfg *apiConfig) chirpAuthors(ctx context.Context, chirps []database.Chirp) (map[string]string, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.UserID)
+	}
+
+	users, err := cfg.queries.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[string]string, len(users))
+	for _, user := range users {
+		if user.Handle.Valid {
+			authors[user.ID.String()] = user.Handle.String
+		}
+	}
+	return authors, nil
+}
+
+// Convert chirps into feed entries, authors maps user IDs to handles
+func (cfg *apiConfig) feedEntries(chirps []database.Chirp, authors map[string]string) []feed.Entry {
+	entries := make([]feed.Entry, len(chirps))
+	for i, chirp := range chirps {
+		title := chirp.Body
+		if utf8.RuneCountInString(title) > feedTitleLength {
+			title = string([]rune(title)[:feedTitleLength]) + "…"
+		}
+
+		entries[i] = feed.Entry{
+			ID:        chirp.ID,
+			Title:     title,
+			Content:   chirp.Body,
+			Link:      fmt.Sprintf("%s/api/chirps/%s", cfg.baseURL, chirp.ID),
+			Author:    authors[chirp.UserID.String()],
+			Published: chirp.CreatedAt,
+			Updated:   chirp.UpdatedAt,
+		}
+	}
+
+	return entries
+}
+
+func feedLimit(r *http.Request) (int32, error) {
+	limitString := r.URL.Query().Get("limit")
+	if limitString == "" {
+		return defaultFeedEntries, nil
+	}
+
+	limit, err := strconv.Atoi(limitString)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 {
+		return 0, fmt.Errorf("Limit must be positive, got %d", limit)
+	}
+	if limit > maxFeedEntries {
+		limit = maxFeedEntries
+	}
+
+	return int32(limit), nil
+}
+
+func writeFeed(w http.ResponseWriter, r *http.Request, f feed.Feed, format feed.Format) {
+	etag := f.ETag(format)
+	lastModified := f.LastModified()
+
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	if feed.NotModified(r, etag, lastModified) {
+		w.WriteHeader(304)
+		return
+	}
+
+	dat, err := f.Render(format)
+	if err != nil {
+		log.Printf("Error rendering feed: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(200)
+	w.Write(dat)
+}
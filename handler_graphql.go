@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"main/internal/auth"
+	"main/internal/graph"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerGraphQL(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	if params.Query == "" || len(params.Query) > graph.MaxQueryLength {
+		log.Printf("Rejecting GraphQL query of length %d", len(params.Query))
+		w.WriteHeader(400)
+		return
+	}
+
+	// Anonymous requests are allowed, but a bad token is still an error
+	viewer := uuid.NullUUID{}
+	if r.Header.Get("Authorization") != "" {
+		userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeProfileRead)
+		if err != nil {
+			log.Printf("Error authorizing header: %s", err)
+			writeAuthError(w, err)
+			return
+		}
+		viewer = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+
+	ctx := graph.WithRequest(r.Context(), cfg.queries, viewer)
+	response := cfg.graphql.Exec(ctx, params.Query, params.OperationName, params.Variables)
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
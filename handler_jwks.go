@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Public keys for services verifying chirpy access tokens on their own
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	dat, err := json.Marshal(cfg.service.JWKS())
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	// Shorter than the lead time before a new key starts signing
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/service"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OAuthApp struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURI  string    `json:"redirect_uri"`
+	Confidential bool      `json:"confidential"`
+	// Only returned when the app is registered
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func oauthAppResponse(app database.OauthApp) OAuthApp {
+	return OAuthApp{
+		ClientID:     app.ID,
+		CreatedAt:    app.CreatedAt,
+		Name:         app.Name,
+		RedirectURI:  app.RedirectUri,
+		Confidential: app.ClientSecretHash.Valid,
+	}
+}
+
+func authorizationRequest(query url.Values) service.AuthorizationRequest {
+	return service.AuthorizationRequest{
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		ResponseType:        query.Get("response_type"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// Write an RFC 6749 error body for OAuth errors, other errors only get a status
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type errorData struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}
+
+	dat, marshalErr := json.Marshal(errorData{
+		Error:       oauthErr.Code,
+		Description: oauthErr.Description,
+	})
+	if marshalErr != nil {
+		log.Printf("Error marshalling json: %s", marshalErr)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(serviceErrorStatus(err))
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerCreateOAuthApp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string `json:"name"`
+		RedirectURI  string `json:"redirect_uri"`
+		Confidential bool   `json:"confidential"`
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	app, secret, err := cfg.service.RegisterApp(r.Context(), userID, service.AppParams{
+		Name:         params.Name,
+		RedirectURI:  params.RedirectURI,
+		Confidential: params.Confidential,
+	})
+	if err != nil {
+		log.Printf("Error registering app: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	response := oauthAppResponse(app)
+	response.ClientSecret = secret
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerListOAuthApps(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	apps, err := cfg.service.ListApps(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting apps: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	response := make([]OAuthApp, len(apps))
+	for i, app := range apps {
+		response[i] = oauthAppResponse(app)
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerDeleteOAuthApp(w http.ResponseWriter, r *http.Request) {
+	appID, err := uuid.Parse(r.PathValue("appID"))
+	if err != nil {
+		log.Printf("Error parsing app id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	err = cfg.service.DeleteApp(r.Context(), userID, appID)
+	if err != nil {
+		log.Printf("Error deleting app: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// Authorization endpoint, sends the user on to the consent screen. Errors are
+// returned to the client once its redirect URI is known to be registered.
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	details, err := cfg.service.ValidateAuthorization(r.Context(), authorizationRequest(r.URL.Query()))
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) && details.RedirectURI != "" {
+		http.Redirect(w, r, details.Redirect(url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+		}), http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error validating authorization request: %s", err)
+		writeOAuthError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/app/authorize.html?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// What the consent screen shows about an authorization request
+func (cfg *apiConfig) handlerOAuthConsentDetails(w http.ResponseWriter, r *http.Request) {
+	type scopeData struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	type consentData struct {
+		ClientID    uuid.UUID   `json:"client_id"`
+		Name        string      `json:"name"`
+		RedirectURI string      `json:"redirect_uri"`
+		Scopes      []scopeData `json:"scopes"`
+	}
+
+	details, err := cfg.service.ValidateAuthorization(r.Context(), authorizationRequest(r.URL.Query()))
+	if err != nil {
+		log.Printf("Error validating authorization request: %s", err)
+		writeOAuthError(w, err)
+		return
+	}
+
+	response := consentData{
+		ClientID:    details.App.ID,
+		Name:        details.App.Name,
+		RedirectURI: details.RedirectURI,
+		Scopes:      make([]scopeData, len(details.Scopes)),
+	}
+	for i, scope := range details.Scopes {
+		response.Scopes[i] = scopeData{Name: scope, Description: auth.GrantableScopes[scope]}
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		ResponseType        string `json:"response_type"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+		Approve             bool   `json:"approve"`
+	}
+
+	type response struct {
+		RedirectURI string `json:"redirect_uri"`
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	redirect, err := cfg.service.AuthorizeApp(r.Context(), userID, service.AuthorizationRequest{
+		ClientID:            params.ClientID,
+		RedirectURI:         params.RedirectURI,
+		ResponseType:        params.ResponseType,
+		Scope:               params.Scope,
+		State:               params.State,
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: params.CodeChallengeMethod,
+	}, params.Approve)
+	if err != nil {
+		log.Printf("Error authorizing app: %s", err)
+		writeOAuthError(w, err)
+		return
+	}
+
+	dat, err := json.Marshal(response{RedirectURI: redirect})
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+// Client credentials from HTTP basic auth, falling back to the form body
+func clientCredentials(r *http.Request) service.ClientCredentials {
+	if id, secret, ok := r.BasicAuth(); ok {
+		return service.ClientCredentials{ClientID: id, ClientSecret: secret}
+	}
+	return service.ClientCredentials{
+		ClientID:     r.PostFormValue("client_id"),
+		ClientSecret: r.PostFormValue("client_secret"),
+	}
+}
+
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	type tokenData struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing form: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	creds := clientCredentials(r)
+
+	var result service.TokenResult
+	switch grantType := r.PostFormValue("grant_type"); grantType {
+	case "authorization_code":
+		result, err = cfg.service.ExchangeAuthorizationCode(r.Context(), creds,
+			r.PostFormValue("code"), r.PostFormValue("redirect_uri"), r.PostFormValue("code_verifier"),
+			service.ClientInfo{UserAgent: r.UserAgent(), IP: clientIP(r)})
+	case "refresh_token":
+		result, err = cfg.service.RefreshAppToken(r.Context(), creds, r.PostFormValue("refresh_token"))
+	default:
+		err = &service.OAuthError{Code: service.OAuthUnsupportedGrantType, Description: "unsupported grant_type " + grantType}
+	}
+	if err != nil {
+		log.Printf("Error issuing OAuth token: %s", err)
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") && serviceErrorStatus(err) == 401 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		writeOAuthError(w, err)
+		return
+	}
+
+	dat, err := json.Marshal(tokenData{
+		AccessToken:  result.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(result.ExpiresIn.Seconds()),
+		RefreshToken: result.RefreshToken,
+		Scope:        result.Scope,
+	})
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+// Token revocation, succeeds for unknown tokens as RFC 7009 requires
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing form: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.RevokeAppToken(r.Context(), clientCredentials(r), r.PostFormValue("token"))
+	if err != nil {
+		log.Printf("Error revoking OAuth token: %s", err)
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
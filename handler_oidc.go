@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"main/internal/service"
+	"net/http"
+	"strings"
+)
+
+// Holds the state of a login started in this browser, so a callback
+// carrying someone else's state and code is refused
+const oidcStateCookie = "oidc_state"
+
+func (cfg *apiConfig) oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		// Lax still sends it on the provider's top-level redirect back
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	url, state, err := cfg.service.BeginOIDCLogin(r.Context(), r.PathValue("provider"))
+	if err != nil {
+		log.Printf("Error starting OIDC login: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	http.SetCookie(w, cfg.oidcCookie(state, int(service.OIDCLoginLifetime.Seconds())))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	http.SetCookie(w, cfg.oidcCookie("", -1))
+
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("OIDC provider returned error: %s %s", providerError, query.Get("error_description"))
+		w.WriteHeader(401)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		log.Print("OIDC callback state does not match the login started in this browser")
+		w.WriteHeader(401)
+		return
+	}
+
+	login, err := cfg.service.CompleteOIDCLogin(r.Context(), r.PathValue("provider"), query.Get("code"), query.Get("state"), service.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	})
+	if err != nil {
+		log.Printf("Error completing OIDC login: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	writeLoginResponse(w, login)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	// Send in the background so the response time doesn't reveal whether the account exists
+	go cfg.service.RequestPasswordReset(context.WithoutCancel(r.Context()), params.Email)
+
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.ResetPassword(r.Context(), params.Token, params.Password)
+	if err != nil {
+		log.Printf("Error resetting password: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/service"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	TokenHint  string     `json:"token_hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// Only returned when the token is created
+	Token string `json:"token,omitempty"`
+}
+
+func personalTokenResponse(token database.PersonalAccessToken) PersonalAccessToken {
+	response := PersonalAccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		TokenHint: token.TokenHint,
+		Scopes:    strings.Fields(token.Scopes),
+		CreatedAt: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		response.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		response.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return response
+}
+
+func (cfg *apiConfig) handlerCreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	stored, token, err := cfg.service.CreatePersonalAccessToken(r.Context(), userID, service.PersonalTokenParams{
+		Name:      params.Name,
+		Scopes:    params.Scopes,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("Error creating personal access token: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	response := personalTokenResponse(stored)
+	response.Token = token
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(201)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerListPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	tokens, err := cfg.service.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting personal access tokens: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	response := make([]PersonalAccessToken, len(tokens))
+	for i, token := range tokens {
+		response[i] = personalTokenResponse(token)
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerRevokePersonalToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("Error parsing token id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	err = cfg.service.RevokePersonalAccessToken(r.Context(), userID, tokenID)
+	if err != nil {
+		log.Printf("Error revoking personal access token: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
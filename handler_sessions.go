@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"main/internal/auth"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	DeviceName string    `json:"device_name,omitempty"`
+	Current    bool      `json:"current"`
+	// Set for sessions granted to a third-party app
+	AppID  *uuid.UUID `json:"app_id,omitempty"`
+	Scopes []string   `json:"scopes,omitempty"`
+}
+
+// Remote address of the request without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) handlerListSessions(w http.ResponseWriter, r *http.Request) {
+	token, err := bearerToken(r.Header)
+	if err != nil {
+		log.Printf("Error getting bearer token: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	claims, err := cfg.service.Authorize(r.Context(), token, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error validating JWT: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	sessions, err := cfg.service.ListSessions(r.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error getting sessions: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	response := make([]Session, len(sessions))
+	for i, session := range sessions {
+		response[i] = Session{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			UserAgent:  session.UserAgent,
+			IP:         session.Ip,
+			DeviceName: session.DeviceName.String,
+			Current:    session.ID == claims.SessionID,
+			Scopes:     strings.Fields(session.Scopes),
+		}
+		if session.AppID.Valid {
+			response[i].AppID = &session.AppID.UUID
+		}
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		log.Printf("Error parsing session id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	err = cfg.service.RevokeSession(r.Context(), userID, sessionID)
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	err = cfg.service.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
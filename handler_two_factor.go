@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"main/internal/auth"
+	"main/internal/service"
+	"net/http"
+)
+
+type twoFactorCode struct {
+	Code string `json:"code"`
+}
+
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		DeviceName     string `json:"device_name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	login, err := cfg.service.CompleteTwoFactorLogin(r.Context(), params.ChallengeToken, params.Code, service.ClientInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		DeviceName: params.DeviceName,
+	})
+	if err != nil {
+		log.Printf("Error completing two-factor login: %s", err)
+		setRetryAfter(w, err)
+		writeAuthError(w, err)
+		return
+	}
+
+	writeLoginResponse(w, login)
+}
+
+func (cfg *apiConfig) handlerBeginTOTP(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	enrolment, err := cfg.service.BeginTOTPEnrolment(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error starting TOTP enrolment: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	dat, err := json.Marshal(response{
+		Secret:     enrolment.Secret,
+		OTPAuthURI: enrolment.URI,
+	})
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerTOTPQRCode(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	png, err := cfg.service.TOTPQRCode(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error rendering TOTP QR code: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(png)
+}
+
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := twoFactorCode{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	codes, err := cfg.service.ConfirmTOTP(r.Context(), userID, params.Code)
+	if err != nil {
+		log.Printf("Error confirming TOTP: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	dat, err := json.Marshal(response{RecoveryCodes: codes})
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error authorizing header: %s", err)
+		writeAuthError(w, err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := twoFactorCode{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	err = cfg.service.DisableTOTP(r.Context(), userID, params.Code)
+	if err != nil {
+		log.Printf("Error disabling two-factor authentication: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(204)
+}
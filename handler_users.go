@@ -1,25 +1,104 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"main/internal/auth"
 	"main/internal/database"
+	"main/internal/service"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
+const maxWebhookBytes = 64 << 10
+
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Handle        string    `json:"handle,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+}
+
+func userResponse(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed.Bool,
+		Handle:        user.Handle.String,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+}
+
+// Map service errors onto HTTP status codes
+func serviceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		return 400
+	case errors.Is(err, service.ErrUnauthorized):
+		return 401
+	case errors.Is(err, service.ErrForbidden):
+		return 403
+	case errors.Is(err, service.ErrNotFound):
+		return 404
+	case errors.Is(err, service.ErrConflict):
+		return 409
+	case errors.Is(err, service.ErrRateLimited):
+		return 429
+	default:
+		return 500
+	}
+}
+
+// Write the status for a failed login or token check, suspended users are
+// told why and until when
+func writeAuthError(w http.ResponseWriter, err error) {
+	var suspended *service.SuspendedError
+	if !errors.As(err, &suspended) {
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type errorData struct {
+		Error          string     `json:"error"`
+		Reason         string     `json:"reason"`
+		SuspendedUntil *time.Time `json:"suspended_until"`
+	}
+
+	response := errorData{Error: "account_suspended", Reason: suspended.Reason}
+	if !suspended.Until.IsZero() {
+		response.SuspendedUntil = &suspended.Until
+	}
+
+	dat, marshalErr := json.Marshal(response)
+	if marshalErr != nil {
+		log.Printf("Error marshalling json: %s", marshalErr)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(403)
+	w.Write(dat)
+}
+
+// Tell rate limited clients when to come back
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var rateLimited *service.RateLimitError
+	if errors.As(err, &rateLimited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimited.RetryAfter.Seconds()))))
+	}
 }
 
 func (cfg *apiConfig) handlerUserCreation(w http.ResponseWriter, r *http.Request) {
@@ -27,6 +106,7 @@ func (cfg *apiConfig) handlerUserCreation(w http.ResponseWriter, r *http.Request
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}
 
 	header := 201
@@ -40,35 +120,18 @@ func (cfg *apiConfig) handlerUserCreation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	log.Print("Creating hashed password")
-	hashed, err := auth.HashPassword(params.Password)
-	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		w.WriteHeader(500)
-		return
-	}
-
-	log.Printf("Creating user with email, %s", params.Email)
-
-	user, err := cfg.queries.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashed,
+	user, err := cfg.service.CreateUser(r.Context(), service.UserParams{
+		Email:    params.Email,
+		Password: params.Password,
+		Handle:   params.Handle,
 	})
 	if err != nil {
-		log.Printf("Error creating user in database: %s", err)
-		w.WriteHeader(500)
+		log.Printf("Error creating user: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	response := User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed.Bool,
-	}
-
-	dat, err := json.Marshal(response)
+	dat, err := json.Marshal(userResponse(user))
 	if err != nil {
 		log.Printf("Error marshalling json: %s", err)
 		w.WriteHeader(500)
@@ -81,7 +144,8 @@ func (cfg *apiConfig) handlerUserCreation(w http.ResponseWriter, r *http.Request
 
 }
 
-func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
+// Write the tokens of a new session, or the challenge when a second factor is required
+func writeLoginResponse(w http.ResponseWriter, login service.LoginResult) {
 
 	type userData struct {
 		ID           uuid.UUID `json:"id"`
@@ -93,130 +157,100 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		IsChirpyRed  bool      `json:"is_chirpy_red"`
 	}
 
-	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+	type challengeData struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		log.Printf("Error reading input json: %s", err)
-		w.WriteHeader(500)
-		return
+	var response interface{} = userData{
+		ID:           login.User.ID,
+		CreatedAt:    login.User.CreatedAt,
+		UpdatedAt:    login.User.UpdatedAt,
+		Email:        login.User.Email,
+		Token:        login.Token,
+		RefreshToken: login.RefreshToken,
+		IsChirpyRed:  login.User.IsChirpyRed.Bool,
 	}
-
-	log.Printf("Getting user with email, %s", params.Email)
-
-	user, err := cfg.queries.GetUserByEmail(r.Context(), params.Email)
-	if err != nil {
-		log.Printf("Error getting user in database: %s", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid email or password"))
-		return
+	if login.ChallengeToken != "" {
+		response = challengeData{
+			TwoFactorRequired: true,
+			ChallengeToken:    login.ChallengeToken,
+		}
 	}
 
-	err = auth.CheckPasswordHash(user.HashedPassword, params.Password)
+	dat, err := json.Marshal(response)
 	if err != nil {
-		log.Printf("Error getting user in database: %s", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid email or password"))
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
 		return
 	}
 
-	// Create JWT
-	token, err := auth.MakeJWT(user.ID, cfg.tokenSecret)
-	if err != nil {
-		log.Printf("Error creating JWT: %s", err)
-		w.WriteHeader(500)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 
-	// Create Refresh Token
-	refreshToken, err := auth.MakeRefreshToken()
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		log.Printf("Error creating Refresh Token: %s", err)
+		log.Printf("Error reading input json: %s", err)
 		w.WriteHeader(500)
 		return
 	}
 
-	refreshTokenJSON, err := cfg.queries.CreateToken(r.Context(), database.CreateTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().UTC().Add(60 * 24 * time.Hour),
+	login, err := cfg.service.Login(r.Context(), params.Email, params.Password, service.ClientInfo{
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		DeviceName: params.DeviceName,
 	})
-	if err != nil {
-		log.Printf("Error creating Refresh Token: %s", err)
-		w.WriteHeader(500)
+	if errors.Is(err, service.ErrUnauthorized) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid email or password"))
 		return
 	}
-
-	response := userData{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefreshToken: refreshTokenJSON.Token,
-		IsChirpyRed:  user.IsChirpyRed.Bool,
-	}
-
-	dat, err := json.Marshal(response)
 	if err != nil {
-		log.Printf("Error marshalling json: %s", err)
-		w.WriteHeader(500)
+		log.Printf("Error logging in: %s", err)
+		setRetryAfter(w, err)
+		writeAuthError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(dat)
-
+	writeLoginResponse(w, login)
 }
 
 func (cfg *apiConfig) handlerTokenRefresh(w http.ResponseWriter, r *http.Request) {
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	refreshToken, err := bearerToken(r.Header)
 	if err != nil {
 		log.Printf("Error getting refresh token: %s", err)
-		w.WriteHeader(500)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	userTokenData, err := cfg.queries.GetUserFromRefreshToken(r.Context(), refreshToken)
+	refreshed, err := cfg.service.RefreshAccessToken(r.Context(), refreshToken)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Printf("No token found: %s", err)
-			w.WriteHeader(401)
-			return
-		}
-		log.Printf("Error finding refresh token and user: %s", err)
-		w.WriteHeader(500)
-		return
-	}
-
-	if userTokenData.ExpiresAt.Before(time.Now().UTC()) || userTokenData.RevokedAt.Valid {
-		log.Print("Refresh Token Invalid\n")
-		w.WriteHeader(401)
-		return
-	}
-
-	//Create JWT
-	jwToken, err := auth.MakeJWT(userTokenData.ID, cfg.tokenSecret)
-	if err != nil {
-		log.Printf("Error creating JWT: %s", err)
-		w.WriteHeader(500)
+		log.Printf("Error refreshing token: %s", err)
+		writeAuthError(w, err)
 		return
 	}
 
 	type Token struct {
-		JWToken string `json:"token"`
+		JWToken      string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	response := Token{
-		JWToken: jwToken,
+		JWToken:      refreshed.Token,
+		RefreshToken: refreshed.RefreshToken,
 	}
 
 	dat, err := json.Marshal(response)
@@ -233,16 +267,16 @@ func (cfg *apiConfig) handlerTokenRefresh(w http.ResponseWriter, r *http.Request
 }
 
 func (cfg *apiConfig) handlerTokenRevoke(w http.ResponseWriter, r *http.Request) {
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	refreshToken, err := bearerToken(r.Header)
 	if err != nil {
 		log.Printf("Error getting refresh token from header: %s", err)
-		w.WriteHeader(500)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	err = cfg.queries.RevokeToken(r.Context(), refreshToken)
+	err = cfg.service.RevokeRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		log.Printf("Error getting refresh token from header: %s", err)
+		log.Printf("Error revoking refresh token: %s", err)
 		w.WriteHeader(401)
 		w.Write([]byte("Invalid token"))
 		return
@@ -256,6 +290,7 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -267,48 +302,25 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Error getting bearer token: %s", err)
-		w.WriteHeader(401)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(accessToken, cfg.tokenSecret)
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
 	if err != nil {
 		log.Printf("Error validating JWT: %s", err)
-		w.WriteHeader(401)
-		return
-	}
-
-	log.Print("Creating hashed password")
-	hashedPassword, err := auth.HashPassword(params.Password)
-	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		w.WriteHeader(500)
+		writeAuthError(w, err)
 		return
 	}
 
-	updatedUser, err := cfg.queries.UpdateUser(r.Context(), database.UpdateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-		ID:             userID,
+	updatedUser, err := cfg.service.UpdateUser(r.Context(), userID, service.UserParams{
+		Email:    params.Email,
+		Password: params.Password,
+		Handle:   params.Handle,
 	})
 	if err != nil {
 		log.Printf("Error updating user: %s", err)
-		w.WriteHeader(500)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	response := User{
-		ID:          updatedUser.ID,
-		CreatedAt:   updatedUser.CreatedAt,
-		UpdatedAt:   updatedUser.UpdatedAt,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed.Bool,
-	}
-
-	dat, err := json.Marshal(response)
+	dat, err := json.Marshal(userResponse(updatedUser))
 	if err != nil {
 		log.Printf("Error marshalling response: %s", err)
 		w.WriteHeader(500)
@@ -321,57 +333,76 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 
 }
 
-func (cfg *apiConfig) handlerRedWebhook(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
+		Token string `json:"token"`
 	}
 
-	apiKey, err := auth.GetAPIKey(r.Header)
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		log.Printf("Error getting API Key: %s", err)
-		w.WriteHeader(500)
+		log.Printf("Error reading input json: %s", err)
+		w.WriteHeader(400)
 		return
 	}
 
-	if apiKey != cfg.polkaKey {
-		log.Print("API Keys dont match")
-		w.WriteHeader(401)
+	user, err := cfg.service.VerifyEmail(r.Context(), params.Token)
+	if err != nil {
+		log.Printf("Error verifying email: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	dat, err := json.Marshal(userResponse(user))
 	if err != nil {
-		log.Printf("Error reading input json: %s", err)
+		log.Printf("Error marshalling response: %s", err)
 		w.WriteHeader(500)
 		return
 	}
 
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(204)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.AuthorizeHeader(r.Context(), r.Header, auth.ScopeAccount)
+	if err != nil {
+		log.Printf("Error validating JWT: %s", err)
+		writeAuthError(w, err)
 		return
 	}
 
-	parsedID, err := uuid.Parse(params.Data.UserID)
+	err = cfg.service.ResendVerification(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error parsing uuid: %s", err)
-		w.WriteHeader(500)
+		setRetryAfter(w, err)
+		log.Printf("Error resending verification email: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
 		return
 	}
 
-	err = cfg.queries.UpdateUserRedByID(r.Context(), parsedID)
+	w.WriteHeader(202)
+}
+
+// Polka deliveries are stored, then verified and applied by the service
+func (cfg *apiConfig) handlerRedWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
 	if err != nil {
-		log.Printf("Error upgrading user: %s", err)
-		w.WriteHeader(404)
+		log.Printf("Error reading webhook body: %s", err)
+		w.WriteHeader(400)
 		return
 	}
 
-	log.Printf("Sucessfully upgraded user")
-	w.WriteHeader(204)
-	return
+	delivery, err := cfg.service.ReceivePolkaWebhook(r.Context(), r.Header, body)
+	if err != nil {
+		log.Printf("Error handling webhook delivery %s: %s", delivery.ID, err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
 
+	if delivery.Status == service.DeliveryDuplicate {
+		log.Printf("Polka event %s already processed", delivery.EventID)
+	}
+	w.WriteHeader(204)
 }
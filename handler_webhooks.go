@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"main/internal/database"
+	"main/internal/service"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookDelivery struct {
+	ID         uuid.UUID  `json:"id"`
+	Provider   string     `json:"provider"`
+	ReceivedAt time.Time  `json:"received_at"`
+	Status     string     `json:"status"`
+	Verified   bool       `json:"verified"`
+	EventID    string     `json:"event_id,omitempty"`
+	EventType  string     `json:"event_type,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	HandledAt  *time.Time `json:"handled_at"`
+	Replays    int32      `json:"replays"`
+}
+
+// A delivery with the request as it was received
+type WebhookDeliveryDetails struct {
+	WebhookDelivery
+	Headers json.RawMessage `json:"headers"`
+	Body    string          `json:"body"`
+}
+
+func webhookDeliveryResponse(delivery database.WebhookDelivery) WebhookDelivery {
+	response := WebhookDelivery{
+		ID:         delivery.ID,
+		Provider:   delivery.Provider,
+		ReceivedAt: delivery.ReceivedAt,
+		Status:     delivery.Status,
+		Verified:   delivery.Verified,
+		EventID:    delivery.EventID,
+		EventType:  delivery.EventType,
+		Error:      delivery.Error,
+		Replays:    delivery.Replays,
+	}
+	if delivery.HandledAt.Valid {
+		response.HandledAt = &delivery.HandledAt.Time
+	}
+	return response
+}
+
+func writeWebhookDelivery(w http.ResponseWriter, delivery database.WebhookDelivery) {
+	dat, err := json.Marshal(WebhookDeliveryDetails{
+		WebhookDelivery: webhookDeliveryResponse(delivery),
+		Headers:         delivery.Headers,
+		Body:            string(delivery.Body),
+	})
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := queryLimit(query)
+	if err != nil {
+		log.Printf("Error parsing limit: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	page, err := cfg.service.ListWebhookDeliveries(r.Context(), service.WebhookDeliveryFilter{
+		Status:  query.Get("status"),
+		EventID: query.Get("event_id"),
+		Cursor:  query.Get("cursor"),
+		Limit:   limit,
+	})
+	if err != nil {
+		log.Printf("Error listing webhook deliveries: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	type pageData struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+		NextCursor string            `json:"next_cursor,omitempty"`
+	}
+
+	response := pageData{Deliveries: make([]WebhookDelivery, len(page.Deliveries)), NextCursor: page.NextCursor}
+	for i, delivery := range page.Deliveries {
+		response.Deliveries[i] = webhookDeliveryResponse(delivery)
+	}
+
+	dat, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling json: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+func (cfg *apiConfig) handlerGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		log.Printf("Error parsing delivery id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	delivery, err := cfg.service.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		log.Printf("Error getting webhook delivery: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	writeWebhookDelivery(w, delivery)
+}
+
+// Responds with the delivery after the replay, its status tells how it went
+func (cfg *apiConfig) handlerReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		log.Printf("Error parsing delivery id: %s", err)
+		w.WriteHeader(400)
+		return
+	}
+
+	force := r.URL.Query().Get("force") == "true"
+	delivery, err := cfg.service.ReplayWebhookDelivery(r.Context(), deliveryID, force)
+	if err != nil {
+		log.Printf("Error replaying webhook delivery: %s", err)
+		w.WriteHeader(serviceErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s replayed webhook delivery %s: %s", requestClaims(r).UserID, deliveryID, delivery.Status)
+	writeWebhookDelivery(w, delivery)
+}
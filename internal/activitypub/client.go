@@ -0,0 +1,205 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const maxResponseBytes = 1 << 20
+
+type Client struct {
+	HTTP *http.Client
+	// AllowHTTP permits plain http remotes and AllowPrivate loopback and
+	// private addresses, both only meant for local development
+	AllowHTTP    bool
+	AllowPrivate bool
+}
+
+// A client for remote servers, dev allows plain http and private addresses
+func NewClient(dev bool) *Client {
+	c := &Client{AllowHTTP: dev, AllowPrivate: dev}
+
+	// Addresses are checked after resolution so DNS cannot point a
+	// public name at an internal service
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: c.checkAddress}
+	c.HTTP = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+	}
+	return c
+}
+
+func (c *Client) checkAddress(network, address string, _ syscall.RawConn) error {
+	if c.AllowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(ip) {
+		return fmt.Errorf("Refusing to contact private address %s", ip)
+	}
+
+	return nil
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+func (c *Client) checkURL(rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "https" && !(c.AllowHTTP && parsed.Scheme == "http") {
+		return nil, fmt.Errorf("Refusing to contact %s over %q", parsed.Host, parsed.Scheme)
+	}
+
+	return parsed, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, rawURL, accept string, signer *Signer, out interface{}) error {
+	if _, err := c.checkURL(rawURL); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+	if signer != nil {
+		if err := signer.Sign(req, nil); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", rawURL, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(out)
+}
+
+// Fetch a remote actor document
+func (c *Client) FetchActor(ctx context.Context, actorURL string, signer *Signer) (Actor, error) {
+	var actor Actor
+	err := c.getJSON(ctx, actorURL, ContentType, signer, &actor)
+	if err != nil {
+		return actor, err
+	}
+	if actor.ID == "" || actor.Inbox == "" || actor.PublicKey.PublicKeyPem == "" {
+		return actor, errors.New("Actor document is missing id, inbox or public key")
+	}
+
+	return actor, nil
+}
+
+// Check that an actor document fetched from fetchedURL speaks for itself:
+// its id is on the same origin, it owns its key and, unless keyID is
+// empty, that key is keyID. Otherwise any server could publish another
+// actor's id with its own key.
+func CheckActor(actor Actor, fetchedURL, keyID string) error {
+	fetched, err := url.Parse(fetchedURL)
+	if err != nil {
+		return err
+	}
+	id, err := url.Parse(actor.ID)
+	if err != nil {
+		return err
+	}
+	if id.Scheme != fetched.Scheme || !strings.EqualFold(id.Host, fetched.Host) {
+		return fmt.Errorf("Actor %s was fetched from a different origin, %s", actor.ID, fetchedURL)
+	}
+	if actor.PublicKey.Owner != actor.ID {
+		return fmt.Errorf("Actor %s does not own its key", actor.ID)
+	}
+	if keyID != "" && actor.PublicKey.ID != keyID {
+		return fmt.Errorf("Actor %s does not publish key %s", actor.ID, keyID)
+	}
+
+	return nil
+}
+
+// Resolve an account such as alice@example.com to its actor URL
+func (c *Client) ResolveAccount(ctx context.Context, account string) (string, error) {
+	account = strings.TrimPrefix(strings.TrimPrefix(account, "acct:"), "@")
+	user, host, ok := strings.Cut(account, "@")
+	if !ok || user == "" || host == "" {
+		return "", fmt.Errorf("Invalid account: %s", account)
+	}
+
+	scheme := "https"
+	if c.AllowHTTP {
+		scheme = "http"
+	}
+	webfingerURL := fmt.Sprintf("%s://%s/.well-known/webfinger?resource=%s", scheme, host, url.QueryEscape("acct:"+account))
+
+	var wf WebFinger
+	if err := c.getJSON(ctx, webfingerURL, "application/jrd+json", nil, &wf); err != nil {
+		return "", err
+	}
+
+	return wf.ActorURL()
+}
+
+// Deliver an activity to a remote inbox
+func (c *Client) Deliver(ctx context.Context, inbox string, activity Activity, signer Signer) error {
+	if _, err := c.checkURL(inbox); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if err := signer.Sign(req, body); err != nil {
+		return err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Delivery to %s returned %d", inbox, resp.StatusCode)
+	}
+
+	return nil
+}
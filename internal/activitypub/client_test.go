@@ -0,0 +1,62 @@
+package activitypub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestCheckActor(t *testing.T) {
+	actor := Actor{
+		ID:    "https://remote.example/users/alice",
+		Inbox: "https://remote.example/users/alice/inbox",
+		PublicKey: PublicKey{
+			ID:    "https://remote.example/users/alice#main-key",
+			Owner: "https://remote.example/users/alice",
+		},
+	}
+	if err := CheckActor(actor, actor.ID, actor.PublicKey.ID); err != nil {
+		t.Fatalf("expected actor to pass, got %v", err)
+	}
+
+	// Published by an attacker's server, claiming the victim's id
+	spoofed := actor
+	spoofed.PublicKey.ID = "https://evil.example/keys/1"
+	if err := CheckActor(spoofed, "https://evil.example/users/mallory", "https://evil.example/keys/1"); err == nil {
+		t.Error("expected actor from a different origin to be rejected")
+	}
+
+	tests := map[string]func(a *Actor){
+		"missing owner":   func(a *Actor) { a.PublicKey.Owner = "" },
+		"different owner": func(a *Actor) { a.PublicKey.Owner = "https://remote.example/users/bob" },
+		"different key":   func(a *Actor) { a.PublicKey.ID = "https://remote.example/users/alice#other-key" },
+	}
+	for name, change := range tests {
+		doc := actor
+		change(&doc)
+		if err := CheckActor(doc, actor.ID, actor.PublicKey.ID); err == nil {
+			t.Errorf("%s: expected actor to be rejected", name)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the request to be refused")
+	}))
+	defer srv.Close()
+
+	client := NewClient(false)
+	client.AllowHTTP = true
+	if _, err := client.FetchActor(context.Background(), srv.URL+"/users/alice", nil); err == nil {
+		t.Error("expected loopback fetch to fail")
+	}
+
+	for addr, want := range map[string]bool{"93.184.215.14": true, "2606:2800:21f:cb07:6820:80da:af6b:8b2c": true, "127.0.0.1": false, "10.1.2.3": false, "100.64.0.1": false, "169.254.169.254": false, "::1": false, "::ffff:192.168.0.1": false, "0.0.0.0": false} {
+		if got := publicAddress(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: expected public %t, got %t", addr, want, got)
+		}
+	}
+}
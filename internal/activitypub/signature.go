@@ -0,0 +1,237 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	keyBits        = 2048
+	maxClockSkew   = time.Hour
+	signedHeaders  = "(request-target) host date digest"
+	signedGetHeads = "(request-target) host date"
+)
+
+type Signer struct {
+	KeyID string
+	Key   *rsa.PrivateKey
+}
+
+// Generate a new RSA key pair encoded as PEM
+func GenerateKeyPair() (privatePEM, publicPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return
+	}
+
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	return
+}
+
+func ParsePrivateKey(privatePEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("Invalid private key PEM")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("Private key is not RSA")
+	}
+
+	return rsaKey, nil
+}
+
+func ParsePublicKey(publicPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicPEM))
+	if block == nil {
+		return nil, errors.New("Invalid public key PEM")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Public key is not RSA")
+	}
+
+	return rsaKey, nil
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Sign an outgoing request with the draft-cavage HTTP Signatures scheme
+func (s Signer) Sign(r *http.Request, body []byte) error {
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := signedGetHeads
+	if r.Method != http.MethodGet {
+		r.Header.Set("Digest", digest(body))
+		headers = signedHeaders
+	}
+
+	signingString, err := buildSigningString(r, strings.Fields(headers))
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		s.KeyID, headers, base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+type signatureParams struct {
+	keyID     string
+	headers   []string
+	signature []byte
+}
+
+func parseSignature(header string) (signatureParams, error) {
+	params := signatureParams{headers: []string{"date"}}
+	if header == "" {
+		return params, errors.New("Missing Signature header")
+	}
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+
+		switch key {
+		case "keyId":
+			params.keyID = value
+		case "headers":
+			params.headers = strings.Fields(strings.ToLower(value))
+		case "signature":
+			signature, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return params, err
+			}
+			params.signature = signature
+		case "algorithm":
+			if value != "rsa-sha256" && value != "hs2019" {
+				return params, fmt.Errorf("Unsupported signature algorithm: %s", value)
+			}
+		}
+	}
+
+	if params.keyID == "" || len(params.signature) == 0 {
+		return params, errors.New("Signature header missing keyId or signature")
+	}
+
+	return params, nil
+}
+
+func buildSigningString(r *http.Request, headers []string) (string, error) {
+	lines := make([]string, len(headers))
+	for i, header := range headers {
+		switch header {
+		case "(request-target)":
+			lines[i] = fmt.Sprintf("(request-target): %s %s", strings.ToLower(r.Method), r.URL.RequestURI())
+		case "host":
+			host := r.Host
+			if host == "" {
+				host = r.URL.Host
+			}
+			lines[i] = "host: " + host
+		default:
+			value := r.Header.Get(header)
+			if value == "" {
+				return "", fmt.Errorf("Signed header %s is missing", header)
+			}
+			lines[i] = header + ": " + value
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Key ID named by the request's Signature header
+func SignatureKeyID(r *http.Request) (string, error) {
+	params, err := parseSignature(r.Header.Get("Signature"))
+	return params.keyID, err
+}
+
+// Verify an incoming signed request against the sender's public key
+func Verify(r *http.Request, body []byte, key *rsa.PublicKey) error {
+	params, err := parseSignature(r.Header.Get("Signature"))
+	if err != nil {
+		return err
+	}
+
+	required := []string{"(request-target)", "host", "date"}
+	if r.Method != http.MethodGet {
+		required = append(required, "digest")
+	}
+	for _, header := range required {
+		if !slices.Contains(params.headers, header) {
+			return fmt.Errorf("Signature does not cover %s", header)
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return err
+	}
+	if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return errors.New("Signature date outside allowed window")
+	}
+
+	if r.Method != http.MethodGet && r.Header.Get("Digest") != digest(body) {
+		return errors.New("Digest does not match body")
+	}
+
+	signingString, err := buildSigningString(r, params.headers)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString))
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], params.signature)
+}
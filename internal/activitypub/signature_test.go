@@ -0,0 +1,72 @@
+package activitypub
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	privatePEM, publicPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Error generating keys: %v", err)
+	}
+	privateKey, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatalf("Error parsing private key: %v", err)
+	}
+	publicKey, err := ParsePublicKey(publicPEM)
+	if err != nil {
+		t.Fatalf("Error parsing public key: %v", err)
+	}
+
+	verified := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		keyID, err := SignatureKeyID(r)
+		if err == nil && keyID != "http://example.com/users/tester#main-key" {
+			t.Errorf("unexpected key id %q", keyID)
+		}
+		verified <- Verify(r, body, publicKey)
+	}))
+	defer srv.Close()
+
+	signer := Signer{KeyID: "http://example.com/users/tester#main-key", Key: privateKey}
+	body := []byte(`{"type":"Follow"}`)
+
+	req, _ := http.NewRequest("POST", srv.URL+"/users/someone/inbox", bytes.NewReader(body))
+	if err := signer.Sign(req, body); err != nil {
+		t.Fatalf("Error signing request: %v", err)
+	}
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("Error sending request: %v", err)
+	}
+	if err := <-verified; err != nil {
+		t.Errorf("Signature did not verify: %v", err)
+	}
+
+	tampered, _ := http.NewRequest("POST", srv.URL+"/users/someone/inbox", bytes.NewReader([]byte(`{"type":"Delete"}`)))
+	signer.Sign(tampered, body)
+	if _, err := http.DefaultClient.Do(tampered); err != nil {
+		t.Fatalf("Error sending request: %v", err)
+	}
+	if err := <-verified; err == nil {
+		t.Errorf("expected tampered body to fail verification")
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	activity, _ := NewActivity("http://example.com/1", "Delete", "http://example.com/users/a", "http://example.com/notes/1")
+	id, err := activity.ObjectID()
+	if err != nil || id != "http://example.com/notes/1" {
+		t.Errorf("expected referenced object id, got %q (%v)", id, err)
+	}
+
+	activity, _ = NewActivity("http://example.com/2", "Create", "http://example.com/users/a", Note{ID: "http://example.com/notes/2", Type: "Note"})
+	id, err = activity.ObjectID()
+	if err != nil || id != "http://example.com/notes/2" {
+		t.Errorf("expected embedded object id, got %q (%v)", id, err)
+	}
+}
@@ -0,0 +1,143 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	ContentType       = "application/activity+json"
+	ActivityStreamsNS = "https://www.w3.org/ns/activitystreams"
+	SecurityNS        = "https://w3id.org/security/v1"
+	PublicCollection  = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type Actor struct {
+	Context           []string   `json:"@context,omitempty"`
+	ID                string     `json:"id"`
+	Type              string     `json:"type"`
+	PreferredUsername string     `json:"preferredUsername"`
+	Name              string     `json:"name,omitempty"`
+	URL               string     `json:"url,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox,omitempty"`
+	Followers         string     `json:"followers,omitempty"`
+	Following         string     `json:"following,omitempty"`
+	Endpoints         *Endpoints `json:"endpoints,omitempty"`
+	PublicKey         PublicKey  `json:"publicKey"`
+}
+
+type Note struct {
+	Context      string   `json:"@context,omitempty"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	Published    string   `json:"published"`
+	URL          string   `json:"url,omitempty"`
+	To           []string `json:"to,omitempty"`
+	Cc           []string `json:"cc,omitempty"`
+}
+
+// Activity keeps its object raw since it may be a URI or an embedded object
+type Activity struct {
+	Context   interface{}     `json:"@context,omitempty"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object"`
+	Published string          `json:"published,omitempty"`
+	To        []string        `json:"to,omitempty"`
+	Cc        []string        `json:"cc,omitempty"`
+}
+
+type OrderedCollection struct {
+	Context      string        `json:"@context"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	OrderedItems []interface{} `json:"orderedItems"`
+}
+
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+// Build an activity wrapping the given object
+func NewActivity(id, activityType, actor string, object interface{}) (Activity, error) {
+	dat, err := json.Marshal(object)
+	if err != nil {
+		return Activity{}, err
+	}
+
+	return Activity{
+		Context: ActivityStreamsNS,
+		ID:      id,
+		Type:    activityType,
+		Actor:   actor,
+		Object:  dat,
+	}, nil
+}
+
+// ID of the activity object, whether it is embedded or referenced by URI
+func (a Activity) ObjectID() (string, error) {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id, nil
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(a.Object, &object); err != nil {
+		return "", err
+	}
+	if object.ID == "" {
+		return "", errors.New("Activity object has no id")
+	}
+
+	return object.ID, nil
+}
+
+// Decode an embedded activity object such as the Follow inside an Undo
+func (a Activity) InnerActivity() (Activity, error) {
+	var inner Activity
+	err := json.Unmarshal(a.Object, &inner)
+	return inner, err
+}
+
+// Decode an embedded Note object
+func (a Activity) Note() (Note, error) {
+	var note Note
+	err := json.Unmarshal(a.Object, &note)
+	return note, err
+}
+
+// WebFinger link pointing at the ActivityPub actor document
+func (wf WebFinger) ActorURL() (string, error) {
+	for _, link := range wf.Links {
+		if link.Rel == "self" && (link.Type == ContentType || link.Type == `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`) {
+			return link.Href, nil
+		}
+	}
+
+	return "", errors.New("WebFinger response has no actor link")
+}
@@ -2,82 +2,194 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 8)
-	if err != nil {
-		return "", err
-	}
+// Claims carried by an access token
+type Claims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	// Set on tokens issued to a third-party app
+	ClientID uuid.UUID
+	// Set when authenticated by a personal access token
+	PersonalTokenID uuid.UUID
+	Scopes          []string
+	// Roles of the user, only carried by first-party tokens
+	Roles []string
+}
 
-	return string(hash), nil
+// Whether the token was issued to a third-party app
+func (c Claims) IsApp() bool {
+	return c.ClientID != uuid.Nil
+}
 
+// Errors from reading and validating tokens. A malformed Authorization header
+// is a bad request, every other failure means the caller is not authenticated.
+var (
+	ErrNoToken         = errors.New("no bearer token")
+	ErrMalformedHeader = errors.New("malformed authorization header")
+	ErrTokenExpired    = errors.New("token expired")
+	ErrInvalidToken    = errors.New("invalid token")
+)
+
+// Value of the token_type claim, so access tokens can't be confused with
+// other JWTs signed by the same keys
+const TokenTypeAccess = "access"
+
+// Claims every access token must carry
+type TokenOptions struct {
+	Issuer   string
+	Audience string
+	// Clock skew allowed between the servers issuing and checking tokens
+	Leeway time.Duration
 }
 
-func CheckPasswordHash(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+var DefaultTokenOptions = TokenOptions{
+	Issuer:   "chirpy",
+	Audience: "chirpy",
+	Leeway:   30 * time.Second,
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	TokenType string   `json:"token_type"`
+	SessionID string   `json:"sid,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
 
-	claims := &jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(1 * time.Hour)),
-		Subject:   userID.String(),
-	}
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return MakeSessionJWT(userID, uuid.Nil, tokenSecret, expiresIn)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", err
+// Make an access token bound to a login session, uuid.Nil means no session
+func MakeSessionJWT(userID, sessionID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return NewKeySet(tokenSecret).MakeAppJWT(userID, sessionID, uuid.Nil, nil, expiresIn)
+}
+
+// Make an access token for a third-party app limited to the granted scopes
+func MakeAppJWT(userID, sessionID, clientID uuid.UUID, scopes []string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return NewKeySet(tokenSecret).MakeAppJWT(userID, sessionID, clientID, scopes, expiresIn)
+}
+
+// Make a first-party access token carrying the user's roles
+func (ks *KeySet) MakeSessionJWT(userID, sessionID uuid.UUID, expiresIn time.Duration, roles ...string) (string, error) {
+	return ks.makeJWT(userID, sessionID, uuid.Nil, nil, roles, expiresIn)
+}
+
+// App tokens never carry roles, apps are limited to their scopes
+func (ks *KeySet) MakeAppJWT(userID, sessionID, clientID uuid.UUID, scopes []string, expiresIn time.Duration) (string, error) {
+	return ks.makeJWT(userID, sessionID, clientID, scopes, nil, expiresIn)
+}
+
+func (ks *KeySet) makeJWT(userID, sessionID, clientID uuid.UUID, scopes, roles []string, expiresIn time.Duration) (string, error) {
+
+	claims := &tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ks.options.Issuer,
+			Audience:  jwt.ClaimStrings{ks.options.Audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		TokenType: TokenTypeAccess,
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+	if clientID != uuid.Nil {
+		claims.ClientID = clientID.String()
+		claims.Scope = strings.Join(scopes, " ")
+	} else {
+		claims.Roles = roles
 	}
 
-	return signed, nil
+	return ks.sign(claims)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (userID uuid.UUID, err error) {
-	type customClaims struct {
-		jwt.RegisteredClaims
-	}
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	return claims.UserID, err
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &customClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// Validate an HS256 access token and return its claims
+func ParseJWT(tokenString, tokenSecret string) (Claims, error) {
+	return NewKeySet(tokenSecret).ParseJWT(tokenString)
+}
 
+// Validate an access token against the key it names and return its claims.
+// The algorithm, issuer, audience, expiry and token type are all required.
+func (ks *KeySet) ParseJWT(tokenString string) (Claims, error) {
+	parsed := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, parsed, ks.verificationKey,
+		jwt.WithValidMethods(ks.algorithms()),
+		jwt.WithIssuer(ks.options.Issuer),
+		jwt.WithAudience(ks.options.Audience),
+		jwt.WithLeeway(ks.options.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return Claims{}, fmt.Errorf("%w: %s", ErrTokenExpired, err)
+	}
 	if err != nil {
-		return
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidToken, err)
 	}
 
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return
+	if parsed.TokenType != TokenTypeAccess {
+		return Claims{}, fmt.Errorf("%w: token_type %q is not an access token", ErrInvalidToken, parsed.TokenType)
 	}
 
-	userID, err = uuid.Parse(userIDString)
+	claims := Claims{}
+	claims.UserID, err = uuid.Parse(parsed.Subject)
 	if err != nil {
-		return
+		return Claims{}, fmt.Errorf("%w: bad subject: %s", ErrInvalidToken, err)
+	}
+
+	if parsed.SessionID != "" {
+		claims.SessionID, err = uuid.Parse(parsed.SessionID)
+		if err != nil {
+			return Claims{}, fmt.Errorf("%w: bad sid: %s", ErrInvalidToken, err)
+		}
+	}
+
+	if parsed.ClientID != "" {
+		claims.ClientID, err = uuid.Parse(parsed.ClientID)
+		if err != nil {
+			return Claims{}, fmt.Errorf("%w: bad client_id: %s", ErrInvalidToken, err)
+		}
+		claims.Scopes = strings.Fields(parsed.Scope)
+	} else {
+		claims.Roles = parsed.Roles
 	}
 
-	return
+	return claims, nil
 
 }
 
+// Access tokens, refresh tokens and personal access tokens all arrive here,
+// personal access tokens are told apart by their prefix
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("Error getting Authorization header")
+		return "", ErrNoToken
+	}
+
+	scheme, token, ok := strings.Cut(authHeader, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", fmt.Errorf("%w: expected Bearer <token>", ErrMalformedHeader)
 	}
-	token := strings.TrimPrefix(authHeader, "Bearer ")
 
 	return token, nil
 }
@@ -91,12 +203,25 @@ func MakeRefreshToken() (string, error) {
 
 }
 
-func GetAPIKey(headers http.Header) (string, error) {
-	apiHeader := headers.Get("Authorization")
-	if apiHeader == "" {
-		return "", errors.New("Error getting API Key")
+// Prefix that marks a personal access token, and lets secret scanners find leaked ones
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
 	}
-	apiKey := strings.TrimPrefix(apiHeader, "ApiKey ")
 
-	return apiKey, nil
+	return PersonalAccessTokenPrefix + hex.EncodeToString(key), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// Digest stored in place of a refresh token, tokens are random enough that no salt is needed
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
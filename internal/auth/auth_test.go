@@ -1,17 +1,23 @@
 package auth
 
 import (
+	"bytes"
+	"errors"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
 )
 
 func TestHashPassword(t *testing.T) {
 	password := "testing"
 	hashed, err := HashPassword(password)
-	err = CheckPasswordHash(hashed, "testing")
+	_, err = CheckPasswordHash(hashed, "testing")
 	if err != nil {
 		t.Errorf("Password does not match hash: %n", err)
 	}
@@ -50,3 +56,282 @@ func TestGetBearerToken(t *testing.T) {
 		t.Errorf("expected token = %q, got = %q", wantToken, token)
 	}
 }
+
+func TestGetBearerTokenRequiresScheme(t *testing.T) {
+	header := http.Header{}
+	if _, err := GetBearerToken(header); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+
+	for _, value := range []string{"testing123", "Basic dXNlcjpwYXNz", "Bearer ", "Bearertesting123"} {
+		header.Set("Authorization", value)
+		if _, err := GetBearerToken(header); !errors.Is(err, ErrMalformedHeader) {
+			t.Errorf("expected %q to be malformed, got %v", value, err)
+		}
+	}
+
+	header.Set("Authorization", "bearer testing123")
+	if token, err := GetBearerToken(header); err != nil || token != "testing123" {
+		t.Errorf("expected scheme to be case-insensitive, got %q, %v", token, err)
+	}
+}
+
+// Claims that pass validation, for tests to break one at a time
+func validClaims() *tokenClaims {
+	return &tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultTokenOptions.Issuer,
+			Audience:  jwt.ClaimStrings{DefaultTokenOptions.Audience},
+			Subject:   uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		TokenType: TokenTypeAccess,
+	}
+}
+
+func TestStrictJWTValidation(t *testing.T) {
+	sign := func(method jwt.SigningMethod, claims *tokenClaims) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString([]byte("potato"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if _, err := ParseJWT(sign(jwt.SigningMethodHS256, validClaims()), "potato"); err != nil {
+		t.Fatalf("expected valid token to pass, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		modify func(c *tokenClaims)
+		want   error
+	}{
+		{"wrong issuer", jwt.SigningMethodHS256, func(c *tokenClaims) { c.Issuer = "evil" }, ErrInvalidToken},
+		{"wrong audience", jwt.SigningMethodHS256, func(c *tokenClaims) { c.Audience = jwt.ClaimStrings{"other"} }, ErrInvalidToken},
+		{"no expiry", jwt.SigningMethodHS256, func(c *tokenClaims) { c.ExpiresAt = nil }, ErrInvalidToken},
+		{"not an access token", jwt.SigningMethodHS256, func(c *tokenClaims) { c.TokenType = "id" }, ErrInvalidToken},
+		{"HS512", jwt.SigningMethodHS512, func(c *tokenClaims) {}, ErrInvalidToken},
+		{"issued in the future", jwt.SigningMethodHS256, func(c *tokenClaims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour)) }, ErrInvalidToken},
+		{"expired", jwt.SigningMethodHS256, func(c *tokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }, ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+			if _, err := ParseJWT(sign(tt.method, claims), "potato"); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Small clock differences are tolerated
+	claims := validClaims()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-5 * time.Second))
+	if _, err := ParseJWT(sign(jwt.SigningMethodHS256, claims), "potato"); err != nil {
+		t.Errorf("expected token within leeway to pass, got %v", err)
+	}
+}
+
+func TestSessionJWT(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	tokenString, err := MakeSessionJWT(userID, sessionID, "potato", time.Minute)
+	if err != nil {
+		t.Fatalf("making JWT: %v", err)
+	}
+
+	claims, err := ParseJWT(tokenString, "potato")
+	if err != nil {
+		t.Fatalf("parsing JWT: %v", err)
+	}
+	if claims.UserID != userID || claims.SessionID != sessionID {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	if _, err := ParseJWT(tokenString, "tomato"); err == nil {
+		t.Error("expected wrong secret to be rejected")
+	}
+
+	expired, _ := MakeJWT(userID, "potato", -time.Minute)
+	if _, err := ParseJWT(expired, "potato"); err == nil {
+		t.Error("expected expired token to be rejected")
+	}
+}
+
+func TestAppJWTScopes(t *testing.T) {
+	userID, sessionID, clientID := uuid.New(), uuid.New(), uuid.New()
+
+	tokenString, err := MakeAppJWT(userID, sessionID, clientID, []string{ScopeProfileRead}, "potato", time.Minute)
+	if err != nil {
+		t.Fatalf("making JWT: %v", err)
+	}
+
+	claims, err := ParseJWT(tokenString, "potato")
+	if err != nil {
+		t.Fatalf("parsing JWT: %v", err)
+	}
+	if !claims.IsApp() || claims.ClientID != clientID {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if !claims.HasScope(ScopeProfileRead) || claims.HasScope(ScopeChirpsWrite) || claims.HasScope(ScopeAccount) {
+		t.Errorf("unexpected scopes %v", claims.Scopes)
+	}
+
+	firstParty, _ := MakeSessionJWT(userID, sessionID, "potato", time.Minute)
+	claims, _ = ParseJWT(firstParty, "potato")
+	if claims.IsApp() || !claims.HasScope(ScopeAccount) {
+		t.Errorf("first-party token should have every scope, got %+v", claims)
+	}
+}
+
+func TestSessionJWTRoles(t *testing.T) {
+	ks := NewKeySet("potato")
+
+	tokenString, err := ks.MakeSessionJWT(uuid.New(), uuid.New(), time.Minute, RoleUser, RoleModerator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ks.ParseJWT(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.HasRole(RoleModerator) || claims.HasRole(RoleAdmin) {
+		t.Errorf("unexpected roles %v", claims.Roles)
+	}
+
+	appToken, _ := ks.MakeAppJWT(uuid.New(), uuid.New(), uuid.New(), []string{ScopeChirpsWrite}, time.Minute)
+	claims, _ = ks.ParseJWT(appToken)
+	if len(claims.Roles) != 0 {
+		t.Errorf("app tokens should carry no roles, got %v", claims.Roles)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("profile:read  chirps:write profile:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(scopes, " ") != "chirps:write profile:read" {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+
+	for _, scope := range []string{"", "account", "chirps:write admin"} {
+		if _, err := ParseScopes(scope); err == nil {
+			t.Errorf("expected %q to be rejected", scope)
+		}
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPersonalAccessToken(token) || len(token) != len(PersonalAccessTokenPrefix)+64 {
+		t.Fatalf("unexpected token %q", token)
+	}
+
+	jwtToken, _ := MakeJWT(uuid.New(), "potato", time.Minute)
+	if IsPersonalAccessToken(jwtToken) {
+		t.Error("expected JWT not to look like a personal access token")
+	}
+
+	claims := Claims{UserID: uuid.New(), PersonalTokenID: uuid.New(), Scopes: []string{ScopeChirpsWrite}}
+	if !claims.HasScope(ScopeChirpsWrite) || claims.HasScope(ScopeAccount) {
+		t.Errorf("personal access token should be limited to its scopes")
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	token, _ := MakeRefreshToken()
+	hashed := HashRefreshToken(token)
+	if hashed == token || len(hashed) != 64 {
+		t.Fatalf("unexpected digest %q", hashed)
+	}
+	if HashRefreshToken(token) != hashed {
+		t.Error("digest is not deterministic")
+	}
+
+	// Must match the conversion in the hashed refresh tokens migration
+	want := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if got := HashRefreshToken("test"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generating secret: %v", err)
+	}
+
+	now := time.Now()
+	code, err := totp.GenerateCode(secret, now)
+	if err != nil {
+		t.Fatalf("generating code: %v", err)
+	}
+
+	step, ok := ValidateTOTP(secret, code, now)
+	if !ok || step != now.Unix()/30 {
+		t.Errorf("expected current code to validate at step %d, got %d, %v", now.Unix()/30, step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(30*time.Second)); !ok {
+		t.Error("expected code from the previous period to be accepted")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(5*time.Minute)); ok {
+		t.Error("expected stale code to be rejected")
+	}
+
+	uri := TOTPURI(secret, "alice@example.com")
+	key, err := otp.NewKeyFromURL(uri)
+	if err != nil || key.Secret() != secret || key.Issuer() != "Chirpy" || key.AccountName() != "alice@example.com" {
+		t.Fatalf("unexpected key from %q: %v", uri, err)
+	}
+
+	png, err := TOTPQRCode(uri, 200)
+	if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("expected a PNG, got %v", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("got %v, %v", codes, err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 14 || seen[code] {
+			t.Errorf("unexpected code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Error("expected recovery code hashing to ignore case and dashes")
+	}
+}
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		actor, target []string
+		want          bool
+	}{
+		{[]string{RoleUser, RoleAdmin}, []string{RoleUser, RoleModerator}, true},
+		{[]string{RoleUser, RoleModerator}, []string{RoleUser}, true},
+		{[]string{RoleUser, RoleModerator}, []string{RoleUser, RoleAdmin}, false},
+		{[]string{RoleUser, RoleModerator}, []string{RoleUser, RoleModerator}, false},
+		{[]string{RoleUser, RoleAdmin}, []string{RoleUser, RoleAdmin}, false},
+		{[]string{RoleUser, "support"}, []string{RoleUser, RoleModerator}, false},
+	}
+	for _, tt := range tests {
+		if got := Outranks(tt.actor, tt.target); got != tt.want {
+			t.Errorf("Outranks(%v, %v): expected %t, got %t", tt.actor, tt.target, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms for asymmetric keys
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var signingMethods = map[string]jwt.SigningMethod{
+	AlgRS256: jwt.SigningMethodRS256,
+	AlgES256: jwt.SigningMethodES256,
+	AlgEdDSA: jwt.SigningMethodEdDSA,
+}
+
+// Key pair used to sign access tokens, published by its key id
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	// The key signs tokens from ActivatesAt and is dropped at RetiresAt,
+	// a zero RetiresAt means the key has not been replaced yet
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+}
+
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := keyID(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: id, Algorithm: algorithm, Private: private}, nil
+}
+
+// Key ids are a digest of the public key, so they are stable and unique
+func keyID(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// PKCS #8 PEM encoding of the private key for storage
+func (k *SigningKey) MarshalPrivateKey() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func ParseSigningKey(id, algorithm, privateKeyPEM string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("no PEM block in private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	key := &SigningKey{ID: id, Algorithm: algorithm, Private: private}
+	if !key.matchesAlgorithm() {
+		return nil, fmt.Errorf("%T key cannot be used for %s", private, algorithm)
+	}
+	return key, nil
+}
+
+func (k *SigningKey) matchesAlgorithm() bool {
+	switch k.Private.(type) {
+	case *rsa.PrivateKey:
+		return k.Algorithm == AlgRS256
+	case *ecdsa.PrivateKey:
+		return k.Algorithm == AlgES256
+	case ed25519.PrivateKey:
+		return k.Algorithm == AlgEdDSA
+	}
+	return false
+}
+
+func (k *SigningKey) retired(now time.Time) bool {
+	return !k.RetiresAt.IsZero() && !now.Before(k.RetiresAt)
+}
+
+// Public key in JSON Web Key form, RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = encode(public.X.FillBytes(make([]byte, 32)))
+		jwk.Y = encode(public.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(public)
+	}
+
+	return jwk
+}
+
+// Keys that sign and verify access tokens. With asymmetric keys the newest
+// active key signs and every unretired key verifies, otherwise tokens are
+// signed with the HMAC secret.
+type KeySet struct {
+	hmacSecret []byte
+	options    TokenOptions
+
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+// An empty secret disables HS256, so only the asymmetric keys are trusted
+func NewKeySet(hmacSecret string) *KeySet {
+	return NewKeySetWithOptions(hmacSecret, DefaultTokenOptions)
+}
+
+func NewKeySetWithOptions(hmacSecret string, options TokenOptions) *KeySet {
+	return &KeySet{hmacSecret: []byte(hmacSecret), options: options}
+}
+
+// Algorithms tokens may be signed with, anything else is rejected before
+// a key is looked up
+func (ks *KeySet) algorithms() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var algorithms []string
+	if len(ks.hmacSecret) > 0 {
+		algorithms = append(algorithms, jwt.SigningMethodHS256.Alg())
+	}
+	for _, key := range ks.keys {
+		if !slices.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+// Replace the asymmetric keys, for example after a rotation
+func (ks *KeySet) SetKeys(keys []*SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+}
+
+// The most recently activated key, nil when signing with the HMAC secret
+func (ks *KeySet) signingKey(now time.Time) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var current *SigningKey
+	for _, key := range ks.keys {
+		if key.ActivatesAt.After(now) || key.retired(now) {
+			continue
+		}
+		if current == nil || key.ActivatesAt.After(current.ActivatesAt) {
+			current = key
+		}
+	}
+
+	if current == nil && len(ks.hmacSecret) == 0 {
+		return nil, errors.New("no active signing key")
+	}
+	return current, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key, err := ks.signingKey(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if key == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(signingMethods[key.Algorithm], claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Look up the verification key named by a token, the algorithm must be the
+// one the key was created for
+func (ks *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if token.Method != jwt.SigningMethodHS256 || len(ks.hmacSecret) == 0 {
+			return nil, errors.New("token has no key id")
+		}
+		return ks.hmacSecret, nil
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.ID != kid || key.retired(time.Now()) {
+			continue
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+		}
+		return key.Private.Public(), nil
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// Public keys of every unretired key, including ones not yet signing so
+// verifiers can fetch them before the first token appears
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if !key.retired(time.Now()) {
+			set.Keys = append(set.Keys, key.JWK())
+		}
+	}
+	return set
+}
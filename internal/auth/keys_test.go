@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestAsymmetricJWT(t *testing.T) {
+	for _, algorithm := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateSigningKey(algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ks := NewKeySet("")
+			ks.SetKeys([]*SigningKey{key})
+
+			userID := uuid.New()
+			tokenString, err := ks.MakeSessionJWT(userID, uuid.New(), time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, &tokenClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Header["kid"] != key.ID || token.Header["alg"] != algorithm {
+				t.Errorf("unexpected header %v", token.Header)
+			}
+
+			claims, err := ks.ParseJWT(tokenString)
+			if err != nil || claims.UserID != userID {
+				t.Fatalf("got %+v, %v", claims, err)
+			}
+
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID || jwks.Keys[0].Algorithm != algorithm {
+				t.Errorf("unexpected JWKS %+v", jwks)
+			}
+
+			// Keys survive storage
+			pemString, err := key.MarshalPrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := ParseSigningKey(key.ID, algorithm, pemString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ks.SetKeys([]*SigningKey{loaded})
+			if _, err := ks.ParseJWT(tokenString); err != nil {
+				t.Errorf("expected reloaded key to verify, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, _ := GenerateSigningKey(AlgES256)
+	old.ActivatesAt = time.Now().Add(-time.Hour)
+
+	ks := NewKeySet("")
+	ks.SetKeys([]*SigningKey{old})
+	oldToken := signTestToken(t, ks)
+
+	// A published key doesn't sign until it activates
+	next, _ := GenerateSigningKey(AlgES256)
+	next.ActivatesAt = time.Now().Add(time.Hour)
+	ks.SetKeys([]*SigningKey{old, next})
+	if keyIDOf(t, signTestToken(t, ks)) != old.ID {
+		t.Error("expected the old key to sign before the new one activates")
+	}
+	if len(ks.JWKS().Keys) != 2 {
+		t.Error("expected the upcoming key to be published")
+	}
+
+	// Once active the new key signs and the old one still verifies until it retires
+	next.ActivatesAt = time.Now().Add(-time.Minute)
+	old.RetiresAt = time.Now().Add(time.Hour)
+	if keyIDOf(t, signTestToken(t, ks)) != next.ID {
+		t.Error("expected the new key to sign once active")
+	}
+	if _, err := ks.ParseJWT(oldToken); err != nil {
+		t.Errorf("expected old token to verify before retirement, got %v", err)
+	}
+
+	old.RetiresAt = time.Now().Add(-time.Second)
+	if _, err := ks.ParseJWT(oldToken); err == nil {
+		t.Error("expected retired key to be rejected")
+	}
+	if len(ks.JWKS().Keys) != 1 {
+		t.Error("expected retired key to be unpublished")
+	}
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+	key, _ := GenerateSigningKey(AlgRS256)
+	ks := NewKeySet("secret")
+	ks.SetKeys([]*SigningKey{key})
+
+	// HS256 token naming the RSA key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	token.Header["kid"] = key.ID
+	forged, _ := token.SignedString([]byte("secret"))
+	if _, err := ks.ParseJWT(forged); err == nil {
+		t.Error("expected HS256 token naming an RSA key to be rejected")
+	}
+
+	// Without an HMAC secret, tokens without a key id are refused
+	hs256, _ := MakeJWT(uuid.New(), "secret", time.Minute)
+	if _, err := NewKeySet("").ParseJWT(hs256); err == nil {
+		t.Error("expected HS256 token to be rejected when HS256 is disabled")
+	}
+
+	if _, err := NewKeySet("").MakeSessionJWT(uuid.New(), uuid.Nil, time.Minute); err == nil {
+		t.Error("expected signing without keys to fail")
+	}
+}
+
+func signTestToken(t *testing.T, ks *KeySet) string {
+	t.Helper()
+	token, err := ks.MakeSessionJWT(uuid.New(), uuid.Nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func keyIDOf(t *testing.T, tokenString string) string {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &tokenClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
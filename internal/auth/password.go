@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match hash")
+	ErrUnknownHash      = errors.New("unknown password hash format")
+)
+
+// A password hashing algorithm. Hashes name the algorithm and parameters
+// they were made with, so the policy can change without breaking old hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Whether the hash was made by this algorithm, with any parameters
+	Recognizes(hash string) bool
+	Verify(hash, password string) error
+	// Whether the hash was made with other parameters than Hash uses now
+	Outdated(hash string) bool
+}
+
+type Argon2id struct {
+	// Memory in KiB
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Second recommended option of RFC 9106
+var DefaultArgon2id = Argon2id{Memory: 64 * 1024, Time: 3, Parallelism: 4, SaltLength: 16, KeyLength: 32}
+
+// Encoded in the PHC string format, $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Time, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a Argon2id) Verify(hash, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a Argon2id) Outdated(hash string) bool {
+	params, _, _, err := parseArgon2id(hash)
+	return err != nil || params != a
+}
+
+// Parameters, salt and key of an encoded argon2id hash
+func parseArgon2id(hash string) (params Argon2id, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownHash, parts[2])
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: bad argon2 parameters: %s", ErrUnknownHash, err)
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: bad argon2 salt: %s", ErrUnknownHash, err)
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: bad argon2 key: %s", ErrUnknownHash, err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b Bcrypt) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b Bcrypt) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (b Bcrypt) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
+
+// Hashes new passwords with Current while still verifying hashes made by
+// the Legacy algorithms, which are replaced on the next successful login
+type PasswordHashing struct {
+	Current PasswordHasher
+	Legacy  []PasswordHasher
+}
+
+// Passwords used to be hashed with bcrypt at cost 8
+var DefaultPasswordHashing = PasswordHashing{
+	Current: DefaultArgon2id,
+	Legacy:  []PasswordHasher{Bcrypt{Cost: 8}},
+}
+
+func (p PasswordHashing) Hash(password string) (string, error) {
+	return p.Current.Hash(password)
+}
+
+// Verify a password, rehash reports that it matched a hash which should be
+// replaced by one from the current hasher
+func (p PasswordHashing) Check(hash, password string) (rehash bool, err error) {
+	if p.Current.Recognizes(hash) {
+		err := p.Current.Verify(hash, password)
+		if err != nil {
+			return false, err
+		}
+		return p.Current.Outdated(hash), nil
+	}
+
+	for _, legacy := range p.Legacy {
+		if legacy.Recognizes(hash) {
+			err := legacy.Verify(hash, password)
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, ErrUnknownHash
+}
+
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHashing.Hash(password)
+}
+
+func CheckPasswordHash(hash, password string) (rehash bool, err error) {
+	return DefaultPasswordHashing.Check(hash, password)
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordBreached = errors.New("password appears in a known data breach")
+)
+
+// Rules a new password must meet
+type PasswordPolicy struct {
+	MinLength int
+	// Known breached passwords, nil skips the check
+	Breached *BreachedPasswords
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8}
+
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w, use at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+	return nil
+}
+
+// Length of the hash prefix selecting a range, as in the Pwned Passwords API
+const breachRangePrefix = 5
+
+// A local copy of the Pwned Passwords list: uppercase SHA-1 hashes with
+// their breach counts, one HASH:COUNT per line sorted by hash. Lookups
+// follow the k-anonymity range model, a binary search finds the range of
+// the first five hex characters and the suffix is compared within it.
+type BreachedPasswords struct {
+	file *os.File
+	size int64
+}
+
+func OpenBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &BreachedPasswords{file: file, size: info.Size()}, nil
+}
+
+func (b *BreachedPasswords) Close() error {
+	return b.file.Close()
+}
+
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := b.Range(digest[:breachRangePrefix])
+	if err != nil {
+		return false, err
+	}
+	return suffixes[digest[breachRangePrefix:]] > 0, nil
+}
+
+// Breach counts by hash suffix for every hash starting with prefix
+func (b *BreachedPasswords) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+
+	start, err := b.rangeStart(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := map[string]int{}
+	scanner := bufio.NewScanner(io.NewSectionReader(b.file, start, b.size-start))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+
+		hash, count, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			continue
+		}
+		suffixes[hash[len(prefix):]] = n
+	}
+	return suffixes, scanner.Err()
+}
+
+// Offset of the first line not sorting before prefix
+func (b *BreachedPasswords) rangeStart(prefix string) (int64, error) {
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := b.lineFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= b.size || line >= prefix {
+			hi = mid
+		} else {
+			// Every offset up to start lands on the same line
+			lo = start + 1
+		}
+	}
+
+	start, _, err := b.lineFrom(lo)
+	return start, err
+}
+
+// The first line starting at or after offset
+func (b *BreachedPasswords) lineFrom(offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Skip to the end of the line offset falls in, unless it starts one
+		start = offset - 1
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(b.file, start, b.size-start))
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		start += int64(len(skipped))
+		if err == io.EOF {
+			return b.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, strings.TrimSpace(line), nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters to keep the tests fast
+var testArgon2id = Argon2id{Memory: 1024, Time: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2id(t *testing.T) {
+	hash, err := testArgon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected encoding %q", hash)
+	}
+
+	if err := testArgon2id.Verify(hash, "correct horse"); err != nil {
+		t.Errorf("expected password to match, got %v", err)
+	}
+	if err := testArgon2id.Verify(hash, "wrong horse"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected mismatch, got %v", err)
+	}
+
+	if testArgon2id.Outdated(hash) {
+		t.Error("expected hash with current parameters to be up to date")
+	}
+	stronger := testArgon2id
+	stronger.Time = 2
+	if !stronger.Outdated(hash) {
+		t.Error("expected hash with other parameters to be outdated")
+	}
+	// Verification uses the parameters in the hash
+	if err := stronger.Verify(hash, "correct horse"); err != nil {
+		t.Errorf("expected password to match with other parameters, got %v", err)
+	}
+}
+
+func TestPasswordHashingRehash(t *testing.T) {
+	hashing := PasswordHashing{Current: testArgon2id, Legacy: []PasswordHasher{Bcrypt{Cost: 4}}}
+
+	legacy, _ := Bcrypt{Cost: 4}.Hash("hunter22")
+	rehash, err := hashing.Check(legacy, "hunter22")
+	if err != nil || !rehash {
+		t.Errorf("expected legacy bcrypt hash to verify and need a rehash, got %v, %v", rehash, err)
+	}
+	if _, err := hashing.Check(legacy, "hunter23"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected mismatch, got %v", err)
+	}
+
+	current, _ := hashing.Hash("hunter22")
+	if rehash, err := hashing.Check(current, "hunter22"); err != nil || rehash {
+		t.Errorf("expected current hash to verify without rehash, got %v, %v", rehash, err)
+	}
+
+	if _, err := hashing.Check("plaintext", "plaintext"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected unknown hash, got %v", err)
+	}
+}
+
+func writeBreachFile(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	var lines []string
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":"+strings.Repeat("1", i+1))
+	}
+	// Neighbours sharing the prefix of "password", which is 5BAA6
+	lines = append(lines, "5BAA60000000000000000000000000000000:3", "5BAA5FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:2")
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	breached, err := OpenBreachedPasswords(writeBreachFile(t, "password", "123456", "qwerty", "letmein", "dragon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer breached.Close()
+
+	for _, password := range []string{"password", "123456", "dragon"} {
+		if found, err := breached.Contains(password); err != nil || !found {
+			t.Errorf("expected %q to be breached, got %v, %v", password, found, err)
+		}
+	}
+	if found, err := breached.Contains("a much better passphrase"); err != nil || found {
+		t.Errorf("expected passphrase not to be breached, got %v, %v", found, err)
+	}
+
+	suffixes, err := breached.Range("5baa6")
+	if err != nil || len(suffixes) != 2 {
+		t.Errorf("expected both hashes in the range, got %v, %v", suffixes, err)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	breached, err := OpenBreachedPasswords(writeBreachFile(t, "password1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer breached.Close()
+
+	policy := PasswordPolicy{MinLength: 8, Breached: breached}
+	if err := policy.Validate("short"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("expected too short, got %v", err)
+	}
+	if err := policy.Validate("password1"); !errors.Is(err, ErrPasswordBreached) {
+		t.Errorf("expected breached, got %v", err)
+	}
+	if err := policy.Validate("ünïcödé!"); err != nil {
+		t.Errorf("expected length to count characters, got %v", err)
+	}
+}
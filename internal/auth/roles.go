@@ -0,0 +1,56 @@
+package auth
+
+import "slices"
+
+// Roles a user can hold, every user has RoleUser
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permissions required by admin endpoints, granted to roles in the database
+const (
+	PermMetricsRead    = "metrics:read"
+	PermLoginsUnlock   = "logins:unlock"
+	PermRolesManage    = "roles:manage"
+	PermDataReset      = "data:reset"
+	PermUsersRead      = "users:read"
+	PermUsersSuspend   = "users:suspend"
+	PermUsersLogout    = "users:logout"
+	PermUsersChirpyRed = "users:chirpy_red"
+	PermUsersDelete    = "users:delete"
+	PermAuditRead      = "audit:read"
+	PermWebhooksRead   = "webhooks:read"
+	PermWebhooksReplay = "webhooks:replay"
+)
+
+func (c Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// Seniority of a role, roles other than the built-in ones rank with moderators
+func roleRank(role string) int {
+	switch role {
+	case RoleUser:
+		return 0
+	case RoleAdmin:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func highestRank(roles []string) int {
+	rank := 0
+	for _, role := range roles {
+		rank = max(rank, roleRank(role))
+	}
+	return rank
+}
+
+// Whether a user with the actor's roles may act on one with the target's,
+// which needs a strictly more senior role
+func Outranks(actor, target []string) bool {
+	return highestRank(actor) > highestRank(target)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Scopes limit what a third-party app may do with a user's access token
+const (
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeFollowsWrite = "follows:write"
+	// Managing the account itself, never granted to apps
+	ScopeAccount = "account"
+)
+
+// Scopes apps may request, with the text shown on the consent screen
+var GrantableScopes = map[string]string{
+	ScopeChirpsWrite:  "Post and delete chirps as you",
+	ScopeProfileRead:  "Read your profile, including your email address",
+	ScopeFollowsWrite: "Follow accounts on other servers as you",
+}
+
+// Parse a space separated scope parameter into sorted, unique grantable scopes
+func ParseScopes(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("no scopes requested")
+	}
+
+	for _, s := range scopes {
+		if _, ok := GrantableScopes[s]; !ok {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+// Tokens from a first-party login may do anything, app tokens and personal
+// access tokens only what their scopes allow
+func (c Claims) HasScope(scope string) bool {
+	if !c.IsApp() && c.PersonalTokenID == uuid.Nil {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
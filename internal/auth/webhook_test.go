@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhookVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	verifier := WebhookVerifier{Secrets: []string{"new-secret", "old-secret"}}
+
+	for _, secret := range []string{"new-secret", "old-secret"} {
+		if err := verifier.Verify(SignWebhook(secret, now, body), body, now.Add(time.Minute)); err != nil {
+			t.Errorf("expected signature with %s to verify, got %v", secret, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		want   error
+	}{
+		{"unknown secret", SignWebhook("other-secret", now, body), body, ErrWebhookSignature},
+		{"tampered body", SignWebhook("new-secret", now, body), []byte(`{"id":"evt_2"}`), ErrWebhookSignature},
+		{"stale", SignWebhook("new-secret", now.Add(-10*time.Minute), body), body, ErrWebhookTimestamp},
+		{"from the future", SignWebhook("new-secret", now.Add(10*time.Minute), body), body, ErrWebhookTimestamp},
+		{"missing signature", "t=1700000000", body, ErrWebhookSignature},
+		{"empty", "", body, ErrWebhookSignature},
+	}
+	for _, tt := range tests {
+		if err := verifier.Verify(tt.header, tt.body, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// During rotation the sender may include a signature for each secret
+	header := SignWebhook("retired-secret", now, body) + ",v1=" + webhookDigest("new-secret", "1700000000", body)
+	if err := verifier.Verify(header, body, now); err != nil {
+		t.Errorf("expected one matching signature to be enough, got %v", err)
+	}
+}
@@ -7,10 +7,46 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpsByUsers = `-- name: CountChirpsByUsers :many
+SELECT user_id, COUNT(*) AS chirp_count FROM chirps
+WHERE user_id = ANY($1::uuid[])
+GROUP BY user_id
+`
+
+type CountChirpsByUsersRow struct {
+	UserID     uuid.UUID
+	ChirpCount int64
+}
+
+func (q *Queries) CountChirpsByUsers(ctx context.Context, userIds []uuid.UUID) ([]CountChirpsByUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpsByUsers, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpsByUsersRow
+	for rows.Next() {
+		var i CountChirpsByUsersRow
+		if err := rows.Scan(&i.UserID, &i.ChirpCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (id, created_at, updated_at, body, user_id)
 VALUES (
@@ -100,6 +136,136 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
+const getChirpsPage = `-- name: GetChirpsPage :many
+SELECT id, created_at, updated_at, body, user_id FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL OR (created_at, id) < ($2, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type GetChirpsPageParams struct {
+	AuthorID        uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpsPage(ctx context.Context, arg GetChirpsPageParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPage,
+		arg.AuthorID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentChirpsByHashtag = `-- name: GetRecentChirpsByHashtag :many
+SELECT id, created_at, updated_at, body, user_id FROM chirps
+WHERE body ~* ('(^|\s)#' || $1::text || '([^[:alnum:]_]|$)')
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetRecentChirpsByHashtagParams struct {
+	Tag        string
+	EntryLimit int32
+}
+
+func (q *Queries) GetRecentChirpsByHashtag(ctx context.Context, arg GetRecentChirpsByHashtagParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentChirpsByHashtag, arg.Tag, arg.EntryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentUserChirps = `-- name: GetRecentUserChirps :many
+SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetRecentUserChirpsParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+func (q *Queries) GetRecentUserChirps(ctx context.Context, arg GetRecentUserChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentUserChirps, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserChirps = `-- name: GetUserChirps :many
 SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1
 `
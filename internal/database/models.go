@@ -6,11 +6,30 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ActorKey struct {
+	UserID        uuid.UUID
+	CreatedAt     time.Time
+	PublicKeyPem  string
+	PrivateKeyPem string
+}
+
+type AuditEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	EventType string
+	ActorID   uuid.NullUUID
+	TargetID  uuid.NullUUID
+	Ip        string
+	UserAgent string
+	Metadata  json.RawMessage
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,20 +38,239 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
+type EmailVerification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follower struct {
+	UserID    uuid.UUID
+	ActorID   string
+	CreatedAt time.Time
+}
+
+type Following struct {
+	UserID     uuid.UUID
+	ActorID    string
+	CreatedAt  time.Time
+	AcceptedAt sql.NullTime
+}
+
+type Identity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type JwtKey struct {
+	ID            string
+	Algorithm     string
+	PrivateKeyPem string
+	CreatedAt     time.Time
+	ActivatesAt   time.Time
+	RetiresAt     sql.NullTime
+}
+
+type LoginChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Attempts  int32
+	UsedAt    sql.NullTime
+}
+
+type LoginThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type OauthApp struct {
+	ID               uuid.UUID
+	OwnerID          uuid.UUID
+	Name             string
+	RedirectUri      string
+	ClientSecretHash sql.NullString
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+type OauthCode struct {
+	ID            uuid.UUID
+	AppID         uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OidcLogin struct {
+	ID           uuid.UUID
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	UsedAt       sql.NullTime
+}
+
+type PasswordReset struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	TokenHint  string
+	Scopes     string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
 type RefreshToken struct {
-	Token     string
+	TokenHash string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type RemoteActor struct {
+	ID                string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	PreferredUsername string
+	Inbox             string
+	SharedInbox       sql.NullString
+	PublicKeyID       string
+	PublicKeyPem      string
+}
+
+type RemoteNote struct {
+	ID          string
+	CreatedAt   time.Time
+	ActorID     string
+	Content     string
+	PublishedAt time.Time
+}
+
+type Role struct {
+	Name        string
+	Description string
+}
+
+type RolePermission struct {
+	Role       string
+	Permission string
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	UserAgent  string
+	Ip         string
+	DeviceName sql.NullString
+	RevokedAt  sql.NullTime
+	AppID      uuid.NullUUID
+	Scopes     string
+}
+
+type Subscription struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	Provider         string
+	ProviderRef      string
+	Plan             string
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	LastEventAt      time.Time
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      sql.NullBool
+	Handle           sql.NullString
+	EmailVerifiedAt  sql.NullTime
+	TotpSecret       sql.NullString
+	TotpEnabledAt    sql.NullTime
+	TotpLastStep     sql.NullInt64
+	SuspendedAt      sql.NullTime
+	SuspendedUntil   sql.NullTime
+	SuspensionReason sql.NullString
+}
+
+type UserRole struct {
+	UserID    uuid.UUID
+	Role      string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID         uuid.UUID
+	Provider   string
+	ReceivedAt time.Time
+	Headers    json.RawMessage
+	Body       []byte
+	Status     string
+	Verified   bool
+	EventID    string
+	EventType  string
+	Error      string
+	HandledAt  sql.NullTime
+	Replays    int32
+}
+
+type WebhookEvent struct {
+	Provider     string
+	EventID      string
+	EventType    string
+	ReceivedAt   time.Time
+	Attempts     int32
+	ProcessedAt  sql.NullTime
+	ClaimedUntil sql.NullTime
 }
@@ -14,35 +14,64 @@ import (
 )
 
 const createToken = `-- name: CreateToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
 VALUES (
 	$1,
     NOW(),
     NOW(),
     $2,
     $3,
-	NULL
-
+	NULL,
+	$4
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, used_at
 `
 
 type CreateTokenParams struct {
-	Token     string
+	TokenHash string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
+	FamilyID  uuid.UUID
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, used_at FROM refresh_tokens
+WHERE token_hash = $1
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UsedAt,
 	)
 	return i, err
 }
@@ -54,7 +83,7 @@ SELECT
 	refresh_tokens.expires_at
 FROM refresh_tokens 
 JOIN users ON refresh_tokens.user_id = users.id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 `
 
 type GetUserFromRefreshTokenRow struct {
@@ -63,8 +92,8 @@ type GetUserFromRefreshTokenRow struct {
 	ExpiresAt time.Time
 }
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (GetUserFromRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, tokenHash)
 	var i GetUserFromRefreshTokenRow
 	err := row.Scan(&i.ID, &i.RevokedAt, &i.ExpiresAt)
 	return i, err
@@ -73,10 +102,61 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (Ge
 const revokeToken = `-- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
+WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)
+	AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeToken, tokenHash)
+	return err
+}
+
+const revokeTokenFamily = `-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+	AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeToken, token)
+func (q *Queries) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeTokenFamily, familyID)
 	return err
 }
+
+const revokeUserTokens = `-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+	AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserTokens, userID)
+	return err
+}
+
+const useRefreshToken = `-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
+	AND used_at IS NULL
+	AND revoked_at IS NULL
+	AND expires_at > NOW()
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, used_at
+`
+
+func (q *Queries) UseRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, useRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UsedAt,
+	)
+	return i, err
+}
@@ -7,29 +7,33 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -38,6 +42,14 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
@@ -51,8 +63,48 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const disableUserTotp = `-- name: DisableUserTotp :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableUserTotp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableUserTotp, id)
+	return err
+}
+
+const enableUserTotp = `-- name: EnableUserTotp :one
+UPDATE users
+SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason
+`
+
+func (q *Queries) EnableUserTotp(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableUserTotp, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason FROM users
 WHERE email = $1
 `
 
@@ -66,25 +118,209 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason FROM users
+WHERE handle = $1
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const getUsersByIDs = `-- name: GetUsersByIDs :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.EmailVerifiedAt,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.SuspendedAt,
+			&i.SuspendedUntil,
+			&i.SuspensionReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const setUserTotpSecret = `-- name: SetUserTotpSecret :one
+UPDATE users
+SET totp_secret = $1, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason
+`
+
+type SetUserTotpSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserTotpSecret, arg.TotpSecret, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET
+	email = $1,
+	hashed_password = $2,
+	handle = COALESCE($3, handle),
+	updated_at = NOW(),
+	email_verified_at = CASE WHEN email = $1 THEN email_verified_at END
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason
 `
 
 type UpdateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
 	ID             uuid.UUID
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -93,17 +329,67 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
 
-const updateUserRedByID = `-- name: UpdateUserRedByID :exec
+const updateUserPassword = `-- name: UpdateUserPassword :one
 UPDATE users
-SET is_chirpy_red = TRUE, updated_at = NOW()
-WHERE id = $1
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, suspended_at, suspended_until, suspension_reason
 `
 
-func (q *Queries) UpdateUserRedByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, updateUserRedByID, id)
-	return err
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const useUserTotpStep = `-- name: UseUserTotpStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)
+`
+
+type UseUserTotpStepParams struct {
+	TotpLastStep sql.NullInt64
+	ID           uuid.UUID
+}
+
+func (q *Queries) UseUserTotpStep(ctx context.Context, arg UseUserTotpStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useUserTotpStep, arg.TotpLastStep, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
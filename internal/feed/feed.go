@@ -0,0 +1,252 @@
+package feed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Format string
+
+const (
+	FormatRSS  Format = "rss"
+	FormatAtom Format = "atom"
+)
+
+type Entry struct {
+	ID        uuid.UUID
+	Title     string
+	Content   string
+	Link      string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+}
+
+type Feed struct {
+	ID          string
+	Title       string
+	Description string
+	Link        string
+	Self        string
+	// Required for Atom, which needs an author for every entry. Entries
+	// without their own author are credited to it.
+	Author  string
+	Updated time.Time
+	Entries []Entry
+}
+
+// Content type sent for each feed format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatAtom:
+		return "application/atom+xml; charset=utf-8"
+	default:
+		return "application/rss+xml; charset=utf-8"
+	}
+}
+
+// Render the feed in the requested format
+func (f Feed) Render(format Format) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case FormatRSS:
+		doc = f.rss()
+	case FormatAtom:
+		if f.Author == "" {
+			return nil, fmt.Errorf("Atom feed %s has no author", f.ID)
+		}
+		doc = f.atom()
+	default:
+		return nil, fmt.Errorf("Unknown feed format: %s", format)
+	}
+
+	dat, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), dat...), nil
+}
+
+// Strong ETag over the feed identity and every entry version
+func (f Feed) ETag(format Format) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%d\n", format, f.ID, f.Updated.UnixNano())
+	for _, entry := range f.Entries {
+		fmt.Fprintf(hash, "%s %d\n", entry.ID, entry.Updated.UnixNano())
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// Latest update across the feed and its entries
+func (f Feed) LastModified() time.Time {
+	lastModified := f.Updated
+	for _, entry := range f.Entries {
+		if entry.Updated.After(lastModified) {
+			lastModified = entry.Updated
+		}
+	}
+
+	return lastModified.UTC()
+}
+
+// Report whether the request's conditional headers match the current feed
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomDoc struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func entryGUID(id uuid.UUID) string {
+	return "urn:uuid:" + id.String()
+}
+
+func (f Feed) rss() rssDoc {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.Link,
+		Description: f.Description,
+		Self:        atomLink{Rel: "self", Type: "application/rss+xml", Href: f.Self},
+		Items:       make([]rssItem, len(f.Entries)),
+	}
+	if lastModified := f.LastModified(); !lastModified.IsZero() {
+		channel.LastBuildDate = lastModified.Format(time.RFC1123Z)
+	}
+
+	for i, entry := range f.Entries {
+		channel.Items[i] = rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			Description: entry.Content,
+			GUID:        rssGUID{IsPermaLink: false, Value: entryGUID(entry.ID)},
+			PubDate:     entry.Published.UTC().Format(time.RFC1123Z),
+		}
+	}
+
+	return rssDoc{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: channel,
+	}
+}
+
+func (f Feed) atom() atomDoc {
+	doc := atomDoc{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: f.LastModified().Format(time.RFC3339),
+		Author:  atomAuthor{Name: f.Author},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Href: f.Link},
+		},
+		Entries: make([]atomEntry, len(f.Entries)),
+	}
+
+	for i, entry := range f.Entries {
+		doc.Entries[i] = atomEntry{
+			ID:        entryGUID(entry.ID),
+			Title:     entry.Title,
+			Published: entry.Published.UTC().Format(time.RFC3339),
+			Updated:   entry.Updated.UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Rel: "alternate", Href: entry.Link}},
+			Author:    atomAuthor{Name: entry.Author},
+			Content:   atomContent{Type: "text", Body: entry.Content},
+		}
+		if entry.Author == "" {
+			doc.Entries[i].Author.Name = f.Author
+		}
+	}
+
+	return doc
+}
@@ -0,0 +1,138 @@
+package feed
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testFeed() Feed {
+	published := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	return Feed{
+		ID:     "urn:uuid:" + uuid.New().String(),
+		Title:  "Chirps by @tester",
+		Link:   "http://localhost:8080/api/chirps",
+		Self:   "http://localhost:8080/users/tester/feed.rss",
+		Author: "tester",
+		Entries: []Entry{{
+			ID:        uuid.New(),
+			Title:     "hello #go",
+			Content:   "hello #go",
+			Link:      "http://localhost:8080/api/chirps/1",
+			Author:    "tester",
+			Published: published,
+			Updated:   published.Add(time.Minute),
+		}},
+	}
+}
+
+func TestRender(t *testing.T) {
+	f := testFeed()
+	guid := "urn:uuid:" + f.Entries[0].ID.String()
+
+	rss, err := f.Render(FormatRSS)
+	if err != nil {
+		t.Fatalf("Error rendering rss: %v", err)
+	}
+	if !strings.Contains(string(rss), `<guid isPermaLink="false">`+guid+`</guid>`) {
+		t.Errorf("rss missing guid: %s", rss)
+	}
+
+	atom, err := f.Render(FormatAtom)
+	if err != nil {
+		t.Fatalf("Error rendering atom: %v", err)
+	}
+	if !strings.Contains(string(atom), "<updated>2025-05-01T12:01:00Z</updated>") {
+		t.Errorf("atom missing updated timestamp: %s", atom)
+	}
+}
+
+func TestAtomAuthors(t *testing.T) {
+	f := testFeed()
+	f.Author = "Chirpy"
+	anonymous := f.Entries[0]
+	anonymous.ID = uuid.New()
+	anonymous.Author = ""
+	f.Entries = append(f.Entries, anonymous)
+
+	dat, err := f.Render(FormatAtom)
+	if err != nil {
+		t.Fatalf("Error rendering atom: %v", err)
+	}
+
+	type author struct {
+		Name string `xml:"name"`
+	}
+	var doc struct {
+		Author  *author `xml:"author"`
+		Entries []struct {
+			Author *author `xml:"author"`
+		} `xml:"entry"`
+	}
+	err = xml.Unmarshal(dat, &doc)
+	if err != nil {
+		t.Fatalf("Error parsing atom: %v", err)
+	}
+	if doc.Author == nil {
+		t.Errorf("atom missing feed author: %s", dat)
+	}
+	if len(doc.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(doc.Entries))
+	}
+	for i, entry := range doc.Entries {
+		if entry.Author == nil || entry.Author.Name == "" {
+			t.Errorf("entry %d has no author: %s", i, dat)
+		}
+	}
+	if doc.Entries[1].Author.Name != "Chirpy" {
+		t.Errorf("expected entry without an author to be credited to the feed, got %q", doc.Entries[1].Author.Name)
+	}
+
+	f.Author = ""
+	if _, err := f.Render(FormatAtom); err == nil {
+		t.Error("expected an atom feed without an author to be refused")
+	}
+}
+
+func TestETag(t *testing.T) {
+	f := testFeed()
+	etag := f.ETag(FormatRSS)
+	if etag == f.ETag(FormatAtom) {
+		t.Errorf("expected different etags per format")
+	}
+
+	f.Entries[0].Updated = f.Entries[0].Updated.Add(time.Second)
+	if etag == f.ETag(FormatRSS) {
+		t.Errorf("expected etag to change when an entry is updated")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	f := testFeed()
+	etag := f.ETag(FormatRSS)
+	lastModified := f.LastModified()
+
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		want   bool
+	}{
+		{"matching etag", "If-None-Match", etag, true},
+		{"stale etag", "If-None-Match", `"stale"`, false},
+		{"not modified since", "If-Modified-Since", lastModified.Format(http.TimeFormat), true},
+		{"modified since", "If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat), false},
+	}
+
+	for _, c := range cases {
+		r, _ := http.NewRequest("GET", "/users/tester/feed.rss", nil)
+		r.Header.Set(c.header, c.value)
+		if got := NotModified(r, etag, lastModified); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
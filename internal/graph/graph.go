@@ -0,0 +1,471 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"main/internal/database"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const (
+	MaxDepth         = 8
+	MaxQueryLength   = 10000
+	MaxComplexity    = 500
+	defaultPageSize  = 20
+	maxPageSize      = 50
+	cursorTimeLayout = time.RFC3339Nano
+)
+
+const schema = `
+	schema {
+		query: Query
+	}
+
+	type Query {
+		me: User
+		user(id: ID, handle: String): User
+		chirp(id: ID!): Chirp
+		chirps(first: Int, after: String, authorId: ID): ChirpConnection!
+	}
+
+	type User {
+		id: ID!
+		handle: String
+		email: String
+		createdAt: Time!
+		isChirpyRed: Boolean!
+		chirpCount: Int!
+		followerCount: Int!
+		chirps(first: Int, after: String): ChirpConnection!
+	}
+
+	type Chirp {
+		id: ID!
+		body: String!
+		createdAt: Time!
+		updatedAt: Time!
+		author: User!
+	}
+
+	type ChirpConnection {
+		edges: [ChirpEdge!]!
+		pageInfo: PageInfo!
+	}
+
+	type ChirpEdge {
+		cursor: String!
+		node: Chirp!
+	}
+
+	type PageInfo {
+		hasNextPage: Boolean!
+		endCursor: String
+	}
+
+	scalar Time
+`
+
+var ErrComplexity = errors.New("Query exceeds the complexity limit")
+
+type Store interface {
+	GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirpsPage(ctx context.Context, arg database.GetChirpsPageParams) ([]database.Chirp, error)
+	GetUserByHandle(ctx context.Context, handle sql.NullString) (database.User, error)
+	GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]database.User, error)
+	CountChirpsByUsers(ctx context.Context, userIds []uuid.UUID) ([]database.CountChirpsByUsersRow, error)
+	CountFollowersByUsers(ctx context.Context, userIds []uuid.UUID) ([]database.CountFollowersByUsersRow, error)
+}
+
+// Parse the schema with depth and parallelism limits
+func NewSchema(store Store) (*graphql.Schema, error) {
+	return graphql.ParseSchema(schema, &Resolver{store: store},
+		graphql.MaxDepth(MaxDepth),
+		graphql.MaxParallelism(10),
+	)
+}
+
+type requestKey struct{}
+
+type requestState struct {
+	viewer      uuid.NullUUID
+	budget      atomic.Int64
+	users       *Loader[uuid.UUID, database.User]
+	chirpCounts *Loader[uuid.UUID, int64]
+	followers   *Loader[uuid.UUID, int64]
+}
+
+// Attach per-request loaders, complexity budget and the authenticated user
+func WithRequest(ctx context.Context, store Store, viewer uuid.NullUUID) context.Context {
+	state := &requestState{viewer: viewer}
+	state.budget.Store(MaxComplexity)
+
+	state.users = NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]database.User, error) {
+		users, err := store.GetUsersByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[uuid.UUID]database.User, len(users))
+		for _, user := range users {
+			results[user.ID] = user
+		}
+		return results, nil
+	})
+
+	state.chirpCounts = NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+		rows, err := store.CountChirpsByUsers(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[uuid.UUID]int64, len(rows))
+		for _, row := range rows {
+			results[row.UserID] = row.ChirpCount
+		}
+		return results, nil
+	})
+
+	state.followers = NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+		rows, err := store.CountFollowersByUsers(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[uuid.UUID]int64, len(rows))
+		for _, row := range rows {
+			results[row.UserID] = row.FollowerCount
+		}
+		return results, nil
+	})
+
+	return context.WithValue(ctx, requestKey{}, state)
+}
+
+func stateFrom(ctx context.Context) (*requestState, error) {
+	state, ok := ctx.Value(requestKey{}).(*requestState)
+	if !ok {
+		return nil, errors.New("GraphQL request state missing from context")
+	}
+	return state, nil
+}
+
+// Charge cost against the request budget
+func spend(ctx context.Context, cost int64) error {
+	state, err := stateFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if state.budget.Add(-cost) < 0 {
+		return ErrComplexity
+	}
+	return nil
+}
+
+type Resolver struct {
+	store Store
+}
+
+func (r *Resolver) Me(ctx context.Context) (*UserResolver, error) {
+	state, err := stateFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !state.viewer.Valid {
+		return nil, errors.New("Authentication required")
+	}
+
+	return r.loadUser(ctx, state.viewer.UUID)
+}
+
+func (r *Resolver) User(ctx context.Context, args struct {
+	ID     *graphql.ID
+	Handle *string
+}) (*UserResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case args.ID != nil:
+		id, err := uuid.Parse(string(*args.ID))
+		if err != nil {
+			return nil, err
+		}
+		return r.loadUser(ctx, id)
+	case args.Handle != nil:
+		user, err := r.store.GetUserByHandle(ctx, sql.NullString{String: strings.ToLower(*args.Handle), Valid: true})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &UserResolver{root: r, user: user}, nil
+	}
+
+	return nil, errors.New("Either id or handle is required")
+}
+
+func (r *Resolver) Chirp(ctx context.Context, args struct{ ID graphql.ID }) (*ChirpResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	chirp, err := r.store.GetChirpByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChirpResolver{root: r, chirp: chirp}, nil
+}
+
+type connectionArgs struct {
+	First *int32
+	After *string
+}
+
+func (r *Resolver) Chirps(ctx context.Context, args struct {
+	First    *int32
+	After    *string
+	AuthorID *graphql.ID
+}) (*ChirpConnectionResolver, error) {
+	author := uuid.NullUUID{}
+	if args.AuthorID != nil {
+		id, err := uuid.Parse(string(*args.AuthorID))
+		if err != nil {
+			return nil, err
+		}
+		author = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	return r.chirpConnection(ctx, author, connectionArgs{First: args.First, After: args.After})
+}
+
+func (r *Resolver) loadUser(ctx context.Context, id uuid.UUID) (*UserResolver, error) {
+	state, err := stateFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, found, err := state.users.Load(ctx, id)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return &UserResolver{root: r, user: user}, nil
+}
+
+func (r *Resolver) chirpConnection(ctx context.Context, author uuid.NullUUID, args connectionArgs) (*ChirpConnectionResolver, error) {
+	pageSize := int32(defaultPageSize)
+	if args.First != nil {
+		pageSize = *args.First
+	}
+	if pageSize < 1 || pageSize > maxPageSize {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxPageSize)
+	}
+
+	if err := spend(ctx, int64(pageSize)); err != nil {
+		return nil, err
+	}
+
+	params := database.GetChirpsPageParams{
+		AuthorID: author,
+		PageSize: pageSize + 1,
+	}
+	if args.After != nil {
+		createdAt, id, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, err
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	chirps, err := r.store.GetChirpsPage(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	hasNext := len(chirps) > int(pageSize)
+	if hasNext {
+		chirps = chirps[:pageSize]
+	}
+
+	return &ChirpConnectionResolver{root: r, chirps: chirps, hasNext: hasNext}, nil
+}
+
+func encodeCursor(chirp database.Chirp) string {
+	raw := chirp.CreatedAt.Format(cursorTimeLayout) + "|" + chirp.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("Invalid cursor")
+	}
+
+	timePart, idPart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("Invalid cursor")
+	}
+
+	createdAt, err := time.Parse(cursorTimeLayout, timePart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("Invalid cursor")
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("Invalid cursor")
+	}
+
+	return createdAt, id, nil
+}
+
+type UserResolver struct {
+	root *Resolver
+	user database.User
+}
+
+func (u *UserResolver) ID() graphql.ID {
+	return graphql.ID(u.user.ID.String())
+}
+
+func (u *UserResolver) Handle() *string {
+	if !u.user.Handle.Valid {
+		return nil
+	}
+	return &u.user.Handle.String
+}
+
+// Email is only visible to the user it belongs to
+func (u *UserResolver) Email(ctx context.Context) *string {
+	state, err := stateFrom(ctx)
+	if err != nil || !state.viewer.Valid || state.viewer.UUID != u.user.ID {
+		return nil
+	}
+	return &u.user.Email
+}
+
+func (u *UserResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: u.user.CreatedAt}
+}
+
+func (u *UserResolver) IsChirpyRed() bool {
+	return u.user.IsChirpyRed.Bool
+}
+
+func (u *UserResolver) ChirpCount(ctx context.Context) (int32, error) {
+	state, err := stateFrom(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, _, err := state.chirpCounts.Load(ctx, u.user.ID)
+	return int32(count), err
+}
+
+func (u *UserResolver) FollowerCount(ctx context.Context) (int32, error) {
+	state, err := stateFrom(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, _, err := state.followers.Load(ctx, u.user.ID)
+	return int32(count), err
+}
+
+func (u *UserResolver) Chirps(ctx context.Context, args connectionArgs) (*ChirpConnectionResolver, error) {
+	return u.root.chirpConnection(ctx, uuid.NullUUID{UUID: u.user.ID, Valid: true}, args)
+}
+
+type ChirpResolver struct {
+	root  *Resolver
+	chirp database.Chirp
+}
+
+func (c *ChirpResolver) ID() graphql.ID {
+	return graphql.ID(c.chirp.ID.String())
+}
+
+func (c *ChirpResolver) Body() string {
+	return c.chirp.Body
+}
+
+func (c *ChirpResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: c.chirp.CreatedAt}
+}
+
+func (c *ChirpResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: c.chirp.UpdatedAt}
+}
+
+func (c *ChirpResolver) Author(ctx context.Context) (*UserResolver, error) {
+	user, err := c.root.loadUser(ctx, c.chirp.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("Author %s not found", c.chirp.UserID)
+	}
+	return user, nil
+}
+
+type ChirpConnectionResolver struct {
+	root    *Resolver
+	chirps  []database.Chirp
+	hasNext bool
+}
+
+func (c *ChirpConnectionResolver) Edges() []*ChirpEdgeResolver {
+	edges := make([]*ChirpEdgeResolver, len(c.chirps))
+	for i, chirp := range c.chirps {
+		edges[i] = &ChirpEdgeResolver{node: &ChirpResolver{root: c.root, chirp: chirp}}
+	}
+	return edges
+}
+
+func (c *ChirpConnectionResolver) PageInfo() *PageInfoResolver {
+	info := &PageInfoResolver{hasNext: c.hasNext}
+	if len(c.chirps) > 0 {
+		cursor := encodeCursor(c.chirps[len(c.chirps)-1])
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type ChirpEdgeResolver struct {
+	node *ChirpResolver
+}
+
+func (e *ChirpEdgeResolver) Cursor() string {
+	return encodeCursor(e.node.chirp)
+}
+
+func (e *ChirpEdgeResolver) Node() *ChirpResolver {
+	return e.node
+}
+
+type PageInfoResolver struct {
+	hasNext   bool
+	endCursor *string
+}
+
+func (p *PageInfoResolver) HasNextPage() bool {
+	return p.hasNext
+}
+
+func (p *PageInfoResolver) EndCursor() *string {
+	return p.endCursor
+}
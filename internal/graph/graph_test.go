@@ -0,0 +1,209 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"main/internal/database"
+
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	users      map[uuid.UUID]database.User
+	chirps     []database.Chirp
+	userCalls  atomic.Int32
+	countCalls atomic.Int32
+}
+
+func (f *fakeStore) GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	for _, chirp := range f.chirps {
+		if chirp.ID == id {
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (f *fakeStore) GetChirpsPage(ctx context.Context, arg database.GetChirpsPageParams) ([]database.Chirp, error) {
+	var page []database.Chirp
+	for _, chirp := range f.chirps {
+		if arg.BeforeCreatedAt.Valid && !chirp.CreatedAt.Before(arg.BeforeCreatedAt.Time) {
+			continue
+		}
+		page = append(page, chirp)
+		if len(page) == int(arg.PageSize) {
+			break
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeStore) GetUserByHandle(ctx context.Context, handle sql.NullString) (database.User, error) {
+	for _, user := range f.users {
+		if user.Handle == handle {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (f *fakeStore) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]database.User, error) {
+	f.userCalls.Add(1)
+	var users []database.User
+	for _, id := range ids {
+		if user, ok := f.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeStore) CountChirpsByUsers(ctx context.Context, userIds []uuid.UUID) ([]database.CountChirpsByUsersRow, error) {
+	f.countCalls.Add(1)
+	var rows []database.CountChirpsByUsersRow
+	for _, id := range userIds {
+		row := database.CountChirpsByUsersRow{UserID: id}
+		for _, chirp := range f.chirps {
+			if chirp.UserID == id {
+				row.ChirpCount++
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (f *fakeStore) CountFollowersByUsers(ctx context.Context, userIds []uuid.UUID) ([]database.CountFollowersByUsersRow, error) {
+	return nil, nil
+}
+
+func newFakeStore() *fakeStore {
+	store := &fakeStore{users: map[uuid.UUID]database.User{}}
+	now := time.Now().UTC()
+	for u := 0; u < 3; u++ {
+		user := database.User{ID: uuid.New(), Handle: sql.NullString{String: "user" + string(rune('a'+u)), Valid: true}}
+		store.users[user.ID] = user
+		for c := 0; c < 4; c++ {
+			store.chirps = append(store.chirps, database.Chirp{
+				ID:        uuid.New(),
+				Body:      "chirp",
+				UserID:    user.ID,
+				CreatedAt: now.Add(-time.Duration(len(store.chirps)) * time.Minute),
+			})
+		}
+	}
+	return store
+}
+
+func TestBatchesAuthorLookups(t *testing.T) {
+	store := newFakeStore()
+	schema, err := NewSchema(store)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	ctx := WithRequest(context.Background(), store, uuid.NullUUID{})
+	resp := schema.Exec(ctx, `{ chirps(first: 12) { edges { node { author { handle chirpCount } } } pageInfo { hasNextPage } } }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", resp.Errors)
+	}
+
+	var data struct {
+		Chirps struct {
+			Edges []struct {
+				Node struct {
+					Author struct {
+						Handle     string
+						ChirpCount int
+					}
+				}
+			}
+			PageInfo struct {
+				HasNextPage bool
+			}
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if len(data.Chirps.Edges) != 12 || data.Chirps.PageInfo.HasNextPage {
+		t.Errorf("expected 12 chirps and no next page, got %d (%v)", len(data.Chirps.Edges), data.Chirps.PageInfo.HasNextPage)
+	}
+	if data.Chirps.Edges[0].Node.Author.ChirpCount != 4 {
+		t.Errorf("expected chirp count 4, got %d", data.Chirps.Edges[0].Node.Author.ChirpCount)
+	}
+	if calls := store.userCalls.Load(); calls != 1 {
+		t.Errorf("expected authors to load in 1 batch, got %d", calls)
+	}
+	if calls := store.countCalls.Load(); calls != 1 {
+		t.Errorf("expected chirp counts to load in 1 batch, got %d", calls)
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	store := newFakeStore()
+	schema, _ := NewSchema(store)
+	ctx := WithRequest(context.Background(), store, uuid.NullUUID{})
+
+	resp := schema.Exec(ctx, `{ chirps(first: 5) { pageInfo { hasNextPage endCursor } } }`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", resp.Errors)
+	}
+
+	var page struct {
+		Chirps struct {
+			PageInfo struct {
+				HasNextPage bool
+				EndCursor   string
+			}
+		}
+	}
+	json.Unmarshal(resp.Data, &page)
+	if !page.Chirps.PageInfo.HasNextPage || page.Chirps.PageInfo.EndCursor == "" {
+		t.Fatalf("expected a next page cursor, got %+v", page.Chirps.PageInfo)
+	}
+
+	resp = schema.Exec(ctx, `query($after: String) { chirps(first: 10, after: $after) { edges { node { id } } } }`, "",
+		map[string]interface{}{"after": page.Chirps.PageInfo.EndCursor})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", resp.Errors)
+	}
+	if count := strings.Count(string(resp.Data), `"id"`); count != 7 {
+		t.Errorf("expected 7 remaining chirps, got %d", count)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	store := newFakeStore()
+	schema, _ := NewSchema(store)
+
+	deep := `{ chirp(id: "` + store.chirps[0].ID.String() + `") { author { chirps { edges { node { author { chirps { edges { node { id } } } } } } } } } }`
+	resp := schema.Exec(WithRequest(context.Background(), store, uuid.NullUUID{}), deep, "", nil)
+	if len(resp.Errors) == 0 {
+		t.Errorf("expected depth limit error")
+	}
+
+	expensive := `{ a: chirps(first: 50) { edges { node { author { chirps(first: 50) { edges { node { id } } } } } } } }`
+	resp = schema.Exec(WithRequest(context.Background(), store, uuid.NullUUID{}), expensive, "", nil)
+	found := false
+	for _, err := range resp.Errors {
+		if strings.Contains(err.Message, ErrComplexity.Error()) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected complexity error, got %v", resp.Errors)
+	}
+
+	resp = schema.Exec(WithRequest(context.Background(), store, uuid.NullUUID{}), `{ me { id } }`, "", nil)
+	if len(resp.Errors) == 0 {
+		t.Errorf("expected me to require authentication")
+	}
+}
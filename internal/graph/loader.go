@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+const batchWait = 2 * time.Millisecond
+
+type loaderResult[V any] struct {
+	value V
+	found bool
+	err   error
+}
+
+type loaderBatch[K comparable, V any] struct {
+	keys    []K
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+// Loader collects keys requested by concurrent resolvers during a short
+// window and fetches them with a single query, caching results per request
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu    sync.Mutex
+	cache map[K]loaderResult[V]
+	batch *loaderBatch[K, V]
+}
+
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch: fetch,
+		cache: map[K]loaderResult[V]{},
+	}
+}
+
+// Load a single key, found is false when the fetch returned no value for it
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (value V, found bool, err error) {
+	l.mu.Lock()
+	if cached, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		return cached.value, cached.found, cached.err
+	}
+
+	batch := l.batch
+	if batch == nil {
+		batch = &loaderBatch[K, V]{done: make(chan struct{})}
+		l.batch = batch
+		go l.dispatch(ctx, batch)
+	}
+	if !slices.Contains(batch.keys, key) {
+		batch.keys = append(batch.keys, key)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return value, false, ctx.Err()
+	}
+
+	value, found = batch.results[key]
+	return value, found, batch.err
+}
+
+func (l *Loader[K, V]) dispatch(ctx context.Context, batch *loaderBatch[K, V]) {
+	time.Sleep(batchWait)
+
+	l.mu.Lock()
+	l.batch = nil
+	keys := batch.keys
+	l.mu.Unlock()
+
+	batch.results, batch.err = l.fetch(ctx, keys)
+
+	l.mu.Lock()
+	for _, key := range keys {
+		value, found := batch.results[key]
+		l.cache[key] = loaderResult[V]{value: value, found: found, err: batch.err}
+	}
+	l.mu.Unlock()
+
+	close(batch.done)
+}
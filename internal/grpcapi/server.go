@@ -0,0 +1,350 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	chirpyv1 "main/internal/pb/chirpyv1"
+	"main/internal/service"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// gRPC front end for the service layer, registers the chirp, user and auth services
+type Server struct {
+	chirpyv1.UnimplementedChirpServiceServer
+	chirpyv1.UnimplementedUserServiceServer
+	chirpyv1.UnimplementedAuthServiceServer
+
+	svc *service.Service
+}
+
+func NewServer(svc *service.Service) *grpc.Server {
+	s := &Server{svc: svc}
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(auditClient))
+	chirpyv1.RegisterChirpServiceServer(srv, s)
+	chirpyv1.RegisterUserServiceServer(srv, s)
+	chirpyv1.RegisterAuthServiceServer(srv, s)
+	return srv
+}
+
+// Map service errors onto gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, service.ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrRateLimited):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		log.Printf("Error handling gRPC request: %s", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// Validate the bearer token in the request metadata and check its scope
+func (s *Server) authenticate(ctx context.Context, scope string) (uuid.UUID, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+
+	userID, err := s.svc.Authenticate(ctx, token, scope)
+	if err != nil {
+		return uuid.Nil, toStatus(err)
+	}
+	return userID, nil
+}
+
+// Describe the calling client for session listings
+func clientInfo(ctx context.Context, deviceName string) service.ClientInfo {
+	client := service.ClientInfo{DeviceName: deviceName}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		client.UserAgent = values[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+
+	return client
+}
+
+// Make the caller's address and user agent available to the audit log
+func auditClient(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(service.WithClient(ctx, clientInfo(ctx, "")), req)
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid id %q", id)
+	}
+	return parsed, nil
+}
+
+func parseOptionalID(id string) (uuid.NullUUID, error) {
+	if id == "" {
+		return uuid.NullUUID{}, nil
+	}
+	parsed, err := parseID(id)
+	return uuid.NullUUID{UUID: parsed, Valid: err == nil}, err
+}
+
+func chirpMessage(chirp database.Chirp) *chirpyv1.Chirp {
+	return &chirpyv1.Chirp{
+		Id:        chirp.ID.String(),
+		CreatedAt: timestamppb.New(chirp.CreatedAt),
+		UpdatedAt: timestamppb.New(chirp.UpdatedAt),
+		Body:      chirp.Body,
+		UserId:    chirp.UserID.String(),
+	}
+}
+
+func userMessage(user database.User) *chirpyv1.User {
+	return &chirpyv1.User{
+		Id:            user.ID.String(),
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+		UpdatedAt:     timestamppb.New(user.UpdatedAt),
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed.Bool,
+		Handle:        user.Handle.String,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+}
+
+func (s *Server) CreateChirp(ctx context.Context, req *chirpyv1.CreateChirpRequest) (*chirpyv1.Chirp, error) {
+	userID, err := s.authenticate(ctx, auth.ScopeChirpsWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	chirp, err := s.svc.CreateChirp(ctx, userID, req.GetBody())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return chirpMessage(chirp), nil
+}
+
+func (s *Server) GetChirp(ctx context.Context, req *chirpyv1.GetChirpRequest) (*chirpyv1.Chirp, error) {
+	chirpID, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	chirp, err := s.svc.GetChirp(ctx, chirpID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return chirpMessage(chirp), nil
+}
+
+func (s *Server) ListChirps(ctx context.Context, req *chirpyv1.ListChirpsRequest) (*chirpyv1.ListChirpsResponse, error) {
+	authorID, err := parseOptionalID(req.GetAuthorId())
+	if err != nil {
+		return nil, err
+	}
+
+	chirps, err := s.svc.ListChirps(ctx, authorID, req.GetSort() == "desc")
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	response := &chirpyv1.ListChirpsResponse{Chirps: make([]*chirpyv1.Chirp, len(chirps))}
+	for i, chirp := range chirps {
+		response.Chirps[i] = chirpMessage(chirp)
+	}
+	return response, nil
+}
+
+func (s *Server) DeleteChirp(ctx context.Context, req *chirpyv1.DeleteChirpRequest) (*emptypb.Empty, error) {
+	userID, err := s.authenticate(ctx, auth.ScopeChirpsWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	chirpID, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.svc.DeleteChirp(ctx, userID, chirpID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Stream newly created chirps until the client goes away
+func (s *Server) StreamChirps(req *chirpyv1.StreamChirpsRequest, stream grpc.ServerStreamingServer[chirpyv1.Chirp]) error {
+	authorID, err := parseOptionalID(req.GetAuthorId())
+	if err != nil {
+		return err
+	}
+
+	events, unsubscribe := s.svc.Events().Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if event.Type != service.ChirpCreated {
+				continue
+			}
+			if authorID.Valid && event.Chirp.UserID != authorID.UUID {
+				continue
+			}
+
+			err := stream.Send(chirpMessage(event.Chirp))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) CreateUser(ctx context.Context, req *chirpyv1.CreateUserRequest) (*chirpyv1.User, error) {
+	user, err := s.svc.CreateUser(ctx, service.UserParams{
+		Email:    req.GetEmail(),
+		Password: req.GetPassword(),
+		Handle:   req.GetHandle(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userMessage(user), nil
+}
+
+func (s *Server) UpdateUser(ctx context.Context, req *chirpyv1.UpdateUserRequest) (*chirpyv1.User, error) {
+	userID, err := s.authenticate(ctx, auth.ScopeAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.svc.UpdateUser(ctx, userID, service.UserParams{
+		Email:    req.GetEmail(),
+		Password: req.GetPassword(),
+		Handle:   req.GetHandle(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userMessage(user), nil
+}
+
+func (s *Server) VerifyEmail(ctx context.Context, req *chirpyv1.VerifyEmailRequest) (*chirpyv1.User, error) {
+	user, err := s.svc.VerifyEmail(ctx, req.GetToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return userMessage(user), nil
+}
+
+func (s *Server) ResendVerification(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	userID, err := s.authenticate(ctx, auth.ScopeAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.svc.ResendVerification(ctx, userID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Login(ctx context.Context, req *chirpyv1.LoginRequest) (*chirpyv1.LoginResponse, error) {
+	login, err := s.svc.Login(ctx, req.GetEmail(), req.GetPassword(), clientInfo(ctx, req.GetDeviceName()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return loginMessage(login), nil
+}
+
+func (s *Server) LoginTwoFactor(ctx context.Context, req *chirpyv1.LoginTwoFactorRequest) (*chirpyv1.LoginResponse, error) {
+	login, err := s.svc.CompleteTwoFactorLogin(ctx, req.GetChallengeToken(), req.GetCode(), clientInfo(ctx, req.GetDeviceName()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return loginMessage(login), nil
+}
+
+func loginMessage(login service.LoginResult) *chirpyv1.LoginResponse {
+	if login.ChallengeToken != "" {
+		return &chirpyv1.LoginResponse{ChallengeToken: login.ChallengeToken}
+	}
+
+	return &chirpyv1.LoginResponse{
+		User:         userMessage(login.User),
+		Token:        login.Token,
+		RefreshToken: login.RefreshToken,
+	}
+}
+
+func (s *Server) Refresh(ctx context.Context, req *chirpyv1.RefreshRequest) (*chirpyv1.RefreshResponse, error) {
+	refreshed, err := s.svc.RefreshAccessToken(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &chirpyv1.RefreshResponse{
+		Token:        refreshed.Token,
+		RefreshToken: refreshed.RefreshToken,
+	}, nil
+}
+
+func (s *Server) Revoke(ctx context.Context, req *chirpyv1.RevokeRequest) (*emptypb.Empty, error) {
+	err := s.svc.RevokeRefreshToken(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ForgotPassword(ctx context.Context, req *chirpyv1.ForgotPasswordRequest) (*emptypb.Empty, error) {
+	go s.svc.RequestPasswordReset(context.WithoutCancel(ctx), req.GetEmail())
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ResetPassword(ctx context.Context, req *chirpyv1.ResetPasswordRequest) (*emptypb.Empty, error) {
+	err := s.svc.ResetPassword(ctx, req.GetToken(), req.GetPassword())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Write each message to a .eml file in Dir for local development, or to the
+// log when Dir is empty. Nothing is delivered.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := ValidateAddress(msg.To); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	data := render(m.From, msg, now)
+
+	if m.Dir == "" {
+		log.Printf("Mail to %s:\n%s", msg.To, strings.ReplaceAll(string(data), "\r\n", "\n"))
+		return nil
+	}
+
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), strings.ReplaceAll(msg.To, "@", "_at_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// A plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Check an address is a single bare address such as "alice@example.com"
+func ValidateAddress(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	if parsed.Name != "" || parsed.Address != address {
+		return fmt.Errorf("expected a bare address, got %q", address)
+	}
+	return nil
+}
+
+// Render a message as RFC 5322 text with CRLF line endings
+func render(from string, msg Message, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
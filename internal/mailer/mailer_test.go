@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Minimal SMTP server that accepts one message and records it
+type fakeSMTP struct {
+	listener net.Listener
+	from     string
+	rcpt     []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case verb == "EHLO" || verb == "HELO":
+			text.PrintfLine("250 fake")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			s.rcpt = append(s.rcpt, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			text.PrintfLine("250 OK")
+		case verb == "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			text.PrintfLine("250 queued")
+		case verb == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unsupported")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTP(t)
+	m := &SMTPMailer{Addr: server.listener.Addr().String(), From: "chirpy@example.com"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "alice@example.com",
+		Subject: "Verify your email",
+		Body:    "Hello\nworld",
+	})
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+	<-server.done
+
+	if server.from != "chirpy@example.com" {
+		t.Errorf("unexpected sender %q", server.from)
+	}
+	if len(server.rcpt) != 1 || server.rcpt[0] != "alice@example.com" {
+		t.Errorf("unexpected recipients %v", server.rcpt)
+	}
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(server.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("parsing message: %v", err)
+	}
+	if msg.Get("Subject") != "Verify your email" || msg.Get("To") != "alice@example.com" {
+		t.Errorf("unexpected headers %v", msg)
+	}
+	if !strings.HasSuffix(server.data, "Hello\nworld\n") {
+		t.Errorf("unexpected body %q", server.data)
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := &FileMailer{Dir: t.TempDir(), From: "chirpy@example.com"}
+	err := m.Send(context.Background(), Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "hi"})
+	if err == nil {
+		t.Fatal("expected injected recipient to be rejected")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := m.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Body: "Body"})
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one message file, got %v, %v", entries, err)
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	if !strings.Contains(string(data), "To: bob@example.com\r\n") || !strings.HasSuffix(string(data), "\r\n\r\nBody") {
+		t.Errorf("unexpected message %q", data)
+	}
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// Deliver mail through an SMTP relay, using STARTTLS when the server offers it
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	// Also rejects header injection through the recipient
+	if err := ValidateAddress(msg.To); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(tlsConfig(host))
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		err = client.Auth(smtp.PlainAuth("", m.Username, m.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(m.From)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(msg.To)
+	if err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(render(m.From, msg, time.Now()))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func tlsConfig(host string) *tls.Config {
+	return &tls.Config{ServerName: host}
+}
@@ -0,0 +1,193 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Minimal provider with discovery, JWKS and a token endpoint that checks PKCE
+type mockProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	clientID  string
+	challenge string
+	nonce     string
+	// Overrides for the issued ID token
+	audience string
+	signer   *rsa.PrivateKey
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockProvider{key: key, clientID: "chirpy"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	mux.HandleFunc("POST /token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+		w.WriteHeader(400)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	audience, signer := m.clientID, m.key
+	if m.audience != "" {
+		audience = m.audience
+	}
+	if m.signer != nil {
+		signer = m.signer
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "user-123",
+		"aud":            audience,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          m.nonce,
+		"email":          "someone@example.com",
+		"email_verified": true,
+	})
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(signer)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// Start a login and record what the provider would receive at /authorize
+func (m *mockProvider) authorize(t *testing.T, p *Provider) (verifier, nonce string) {
+	verifier, nonce = GenerateVerifier(), "nonce-value"
+	authURL, err := p.AuthCodeURL(context.Background(), "state-value", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize") || query.Get("state") != "state-value" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("client_id") != m.clientID {
+		t.Fatalf("unexpected auth URL %s", authURL)
+	}
+
+	m.challenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+	return verifier, nonce
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:        "mock",
+		IssuerURL:   m.server.URL,
+		ClientID:    m.clientID,
+		RedirectURL: "http://localhost:8080/api/oidc/mock/callback",
+	})
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	verifier, nonce := m.authorize(t, p)
+
+	identity, err := p.Exchange(context.Background(), "good-code", verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "user-123" || identity.Email != "someone@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(m *mockProvider, verifier, nonce *string)
+	}{
+		{"wrong PKCE verifier", func(m *mockProvider, verifier, nonce *string) { *verifier = GenerateVerifier() }},
+		{"nonce mismatch", func(m *mockProvider, verifier, nonce *string) { *nonce = "other-nonce" }},
+		{"wrong audience", func(m *mockProvider, verifier, nonce *string) { m.audience = "someone-else" }},
+		{"bad signature", func(m *mockProvider, verifier, nonce *string) { m.signer = otherKey }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			p := m.provider()
+			verifier, nonce := m.authorize(t, p)
+			tt.setup(m, &verifier, &nonce)
+
+			_, err := p.Exchange(context.Background(), "good-code", verifier, nonce)
+			if err == nil {
+				t.Fatal("expected exchange to fail")
+			}
+		})
+	}
+}
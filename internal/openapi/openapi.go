@@ -0,0 +1,22 @@
+package openapi
+
+import (
+	"embed"
+)
+
+// OpenAPI 3.1 document describing every route registered in main.go
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Redoc page rendering Spec, with the Redoc bundle served from the binary
+// so the docs work offline and without third-party scripts
+//
+//go:generate curl -sSfL -o docs/redoc.standalone.js https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js
+//go:embed docs
+var Docs embed.FS
+
+const (
+	DocsPage   = "docs/index.html"
+	DocsScript = "docs/redoc.standalone.js"
+)
@@ -0,0 +1,108 @@
+package openapi
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Collect the patterns passed to mux.Handle and mux.HandleFunc in main.go
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "../../main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Error parsing main.go: %v", err)
+	}
+
+	var patterns []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); !ok || ident.Name != "mux" {
+			return true
+		}
+
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			t.Errorf("route pattern is not a string literal")
+			return true
+		}
+
+		pattern, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Errorf("Error unquoting pattern %s: %v", lit.Value, err)
+			return true
+		}
+		patterns = append(patterns, pattern)
+		return true
+	})
+
+	if len(patterns) == 0 {
+		t.Fatal("no routes found in main.go")
+	}
+
+	return patterns
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(Spec, &spec); err != nil {
+		t.Fatalf("Error parsing openapi.json: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1") {
+		t.Errorf("expected OpenAPI 3.1, got %q", spec.OpenAPI)
+	}
+
+	registered := map[string]bool{}
+	for _, pattern := range registeredRoutes(t) {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = "GET", pattern
+		}
+		method = strings.ToLower(method)
+		registered[method+" "+path] = true
+
+		if _, ok := spec.Paths[path][method]; !ok {
+			t.Errorf("route %q is missing from openapi.json", pattern)
+		}
+	}
+
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[method+" "+path] {
+				t.Errorf("openapi.json documents %s %s which is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestDocsPageIsSelfContained(t *testing.T) {
+	page, err := Docs.ReadFile(DocsPage)
+	if err != nil {
+		t.Fatalf("Error reading docs page: %v", err)
+	}
+	if strings.Contains(string(page), "://") {
+		t.Error("expected the docs page to load nothing from other hosts")
+	}
+	if !strings.Contains(string(page), `src="/api/docs/redoc.standalone.js"`) {
+		t.Error("expected the docs page to load the embedded Redoc bundle")
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Returned to suspended users, matches ErrForbidden
+type SuspendedError struct {
+	Reason string
+	// Zero while the suspension has no end
+	Until time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	if e.Until.IsZero() {
+		return fmt.Sprintf("account suspended: %s", e.Reason)
+	}
+	return fmt.Sprintf("account suspended until %s: %s", e.Until.Format(time.RFC3339), e.Reason)
+}
+
+func (e *SuspendedError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// The user's suspension, nil when there is none or it has run out
+func suspension(user database.User, now time.Time) error {
+	if !user.SuspendedAt.Valid {
+		return nil
+	}
+	if user.SuspendedUntil.Valid && !user.SuspendedUntil.Time.After(now) {
+		return nil
+	}
+
+	err := &SuspendedError{Reason: user.SuspensionReason.String}
+	if user.SuspendedUntil.Valid {
+		err.Until = user.SuspendedUntil.Time
+	}
+	return err
+}
+
+// Refuse tokens and logins of suspended users
+func (s *Service) checkSuspended(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.getUser(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: user no longer exists", ErrUnauthorized)
+	}
+	if err != nil {
+		return err
+	}
+	return suspension(user, time.Now().UTC())
+}
+
+type UserFilter struct {
+	// Part of an email address or handle
+	Search string
+	// From a previous page, empty for the first one
+	Cursor string
+	Limit  int
+}
+
+type UserPage struct {
+	Users []database.User
+	// Empty on the last page
+	NextCursor string
+}
+
+// Newest accounts first, paged by creation time
+func (s *Service) ListUsers(ctx context.Context, filter UserFilter) (UserPage, error) {
+	limit := pageSize(filter.Limit)
+
+	params := database.SearchUsersParams{
+		Search:   escapeLike(strings.TrimSpace(filter.Search)),
+		PageSize: int32(limit + 1),
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	users, err := s.queries.SearchUsers(ctx, params)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	page := UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = encodeCursor(page.Users[limit-1].CreatedAt, page.Users[limit-1].ID)
+	}
+	return page, nil
+}
+
+// Match the search literally, % and _ are not wildcards
+func escapeLike(search string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search)
+}
+
+type UserDetails struct {
+	User     database.User
+	Roles    []string
+	Activity database.GetUserActivityRow
+	// Nil for users who never had Chirpy Red
+	Subscription *database.Subscription
+}
+
+func (s *Service) GetUserDetails(ctx context.Context, userID uuid.UUID) (UserDetails, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return UserDetails{}, err
+	}
+
+	roles, err := s.userRoles(ctx, userID)
+	if err != nil {
+		return UserDetails{}, err
+	}
+
+	activity, err := s.queries.GetUserActivity(ctx, userID)
+	if err != nil {
+		return UserDetails{}, err
+	}
+
+	details := UserDetails{User: user, Roles: roles, Activity: activity}
+	subscription, err := s.queries.GetUserSubscription(ctx, userID)
+	if err == nil {
+		details.Subscription = &subscription
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return UserDetails{}, err
+	}
+	return details, nil
+}
+
+// Operators may only act on users whose roles rank below their own. Without
+// an operator in ctx, as from the admin CLI, anyone may be acted on.
+// Returns the target's roles.
+func (s *Service) checkOutranked(ctx context.Context, targetID uuid.UUID) ([]string, error) {
+	roles, err := s.userRoles(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	actorID, ok := ctx.Value(actorContextKey).(uuid.UUID)
+	if !ok {
+		return roles, nil
+	}
+	actorRoles, err := s.userRoles(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.Outranks(actorRoles, roles) {
+		return nil, fmt.Errorf("%w: cannot act on a user with an equal or higher role", ErrForbidden)
+	}
+	return roles, nil
+}
+
+// Suspend an account until the given time, or until lifted when until is
+// zero. The last active admin cannot be suspended.
+func (s *Service) SuspendUser(ctx context.Context, userID uuid.UUID, reason string, until time.Time) (database.User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return database.User{}, fmt.Errorf("%w: a reason is required", ErrInvalid)
+	}
+	if !until.IsZero() && !until.After(time.Now()) {
+		return database.User{}, fmt.Errorf("%w: suspension must end in the future", ErrInvalid)
+	}
+
+	target, err := s.getUser(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	roles, err := s.checkOutranked(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if slices.Contains(roles, auth.RoleAdmin) && suspension(target, time.Now()) == nil {
+		admins, err := s.queries.CountActiveUsersWithRole(ctx, auth.RoleAdmin)
+		if err != nil {
+			return database.User{}, err
+		}
+		if admins <= 1 {
+			return database.User{}, fmt.Errorf("%w: cannot suspend the last admin", ErrConflict)
+		}
+	}
+
+	user, err := s.queries.SuspendUser(ctx, database.SuspendUserParams{
+		ID:               userID,
+		SuspendedUntil:   sql.NullTime{Time: until.UTC(), Valid: !until.IsZero()},
+		SuspensionReason: sql.NullString{String: reason, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+
+	metadata := AuditMetadata{"reason": reason, "until": nil}
+	if !until.IsZero() {
+		metadata["until"] = until.UTC()
+	}
+	s.audit(ctx, EventUserSuspended, userID, metadata)
+	return user, nil
+}
+
+// Lift a suspension, held to the same rank check as SuspendUser
+func (s *Service) UnsuspendUser(ctx context.Context, userID uuid.UUID) (database.User, error) {
+	_, err := s.getUser(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	_, err = s.checkOutranked(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := s.queries.UnsuspendUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+
+	s.audit(ctx, EventUserUnsuspended, userID, nil)
+	return user, nil
+}
+
+// Revoke every session and token of the user
+func (s *Service) ForceLogout(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.checkOutranked(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventForcedLogout, userID, nil)
+	return nil
+}
+
+// Delete every account, for resetting a development database
+func (s *Service) DeleteAllUsers(ctx context.Context) error {
+	err := s.queries.DeleteUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventUsersReset, uuid.Nil, nil)
+	return nil
+}
+
+// Delete the account and everything it owns, the last active admin cannot
+// be deleted
+func (s *Service) DeleteUser(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	roles, err := s.checkOutranked(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(roles, auth.RoleAdmin) && suspension(user, time.Now()) == nil {
+		admins, err := s.queries.CountActiveUsersWithRole(ctx, auth.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return fmt.Errorf("%w: cannot delete the last admin", ErrConflict)
+		}
+	}
+
+	deleted, err := s.queries.DeleteUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	// Audit events outlive the account
+	s.audit(ctx, EventUserDeleted, userID, AuditMetadata{"email": user.Email, "handle": user.Handle.String})
+	return nil
+}
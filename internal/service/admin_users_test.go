@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"main/internal/auth"
+	"main/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Users with their roles, and how many admins are active
+func newAdminService(t *testing.T, roles map[uuid.UUID][]string, activeAdmins int64) *Service {
+	t.Helper()
+	suspended := database.User{
+		SuspendedAt:      sql.NullTime{Time: time.Now(), Valid: true},
+		SuspensionReason: sql.NullString{String: "spam", Valid: true},
+	}
+	return newFakeService(t, Config{TokenSecret: "secret"}, map[string]func([]driver.Value) (any, error){
+		"GetUserByID": func(args []driver.Value) (any, error) {
+			id := uuid.MustParse(args[0].(string))
+			if _, ok := roles[id]; !ok {
+				return nil, nil
+			}
+			user := suspended
+			user.ID = id
+			return user, nil
+		},
+		"GetUserRoles": func(args []driver.Value) (any, error) {
+			return roles[uuid.MustParse(args[0].(string))], nil
+		},
+		"CountActiveUsersWithRole": func(args []driver.Value) (any, error) { return activeAdmins, nil },
+		"SuspendUser": func(args []driver.Value) (any, error) {
+			return database.User{ID: uuid.MustParse(args[0].(string))}, nil
+		},
+		"UnsuspendUser": func(args []driver.Value) (any, error) {
+			return database.User{ID: uuid.MustParse(args[0].(string))}, nil
+		},
+		"DeleteUser":                     func(args []driver.Value) (any, error) { return int64(1), nil },
+		"RoleExists":                     func(args []driver.Value) (any, error) { return true, nil },
+		"GrantUserRole":                  func(args []driver.Value) (any, error) { return int64(1), nil },
+		"RevokeUserRole":                 func(args []driver.Value) (any, error) { return int64(1), nil },
+		"CountUsersWithRole":             func(args []driver.Value) (any, error) { return activeAdmins, nil },
+		"RevokeUserSessions":             func(args []driver.Value) (any, error) { return int64(0), nil },
+		"RevokeUserTokens":               func(args []driver.Value) (any, error) { return int64(0), nil },
+		"RevokeUserPersonalAccessTokens": func(args []driver.Value) (any, error) { return int64(0), nil },
+		"CreateAuditEvent":               func(args []driver.Value) (any, error) { return int64(1), nil },
+	})
+}
+
+func TestOperatorsCannotActOnPeers(t *testing.T) {
+	admin, peer, user := uuid.New(), uuid.New(), uuid.New()
+	s := newAdminService(t, map[uuid.UUID][]string{
+		admin: {auth.RoleAdmin},
+		peer:  {auth.RoleAdmin},
+		user:  nil,
+	}, 2)
+	ctx := WithActor(context.Background(), admin)
+
+	if _, err := s.SuspendUser(ctx, peer, "spam", time.Time{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("suspending a peer: expected ErrForbidden, got %v", err)
+	}
+	if _, err := s.UnsuspendUser(ctx, peer); !errors.Is(err, ErrForbidden) {
+		t.Errorf("unsuspending a peer: expected ErrForbidden, got %v", err)
+	}
+	if err := s.DeleteUser(ctx, peer); !errors.Is(err, ErrForbidden) {
+		t.Errorf("deleting a peer: expected ErrForbidden, got %v", err)
+	}
+
+	if _, err := s.SuspendUser(ctx, user, "spam", time.Time{}); err != nil {
+		t.Errorf("suspending a user: %v", err)
+	}
+	if _, err := s.UnsuspendUser(ctx, user); err != nil {
+		t.Errorf("unsuspending a user: %v", err)
+	}
+	if err := s.DeleteUser(ctx, user); err != nil {
+		t.Errorf("deleting a user: %v", err)
+	}
+}
+
+func TestOperatorsCannotGrantOrRevokeAtTheirRank(t *testing.T) {
+	admin, peer, moderator, user := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	s := newAdminService(t, map[uuid.UUID][]string{
+		admin:     {auth.RoleAdmin},
+		peer:      {auth.RoleAdmin},
+		moderator: {auth.RoleModerator},
+		user:      nil,
+	}, 2)
+	ctx := WithActor(context.Background(), admin)
+
+	if err := s.RevokeRole(ctx, peer, auth.RoleAdmin); !errors.Is(err, ErrForbidden) {
+		t.Errorf("revoking a peer's role: expected ErrForbidden, got %v", err)
+	}
+	if err := s.GrantRole(ctx, user, auth.RoleAdmin); !errors.Is(err, ErrForbidden) {
+		t.Errorf("granting the operator's own role: expected ErrForbidden, got %v", err)
+	}
+	if err := s.GrantRole(ctx, peer, auth.RoleModerator); !errors.Is(err, ErrForbidden) {
+		t.Errorf("granting to a peer: expected ErrForbidden, got %v", err)
+	}
+
+	if err := s.GrantRole(ctx, user, auth.RoleModerator); err != nil {
+		t.Errorf("granting a lower role: %v", err)
+	}
+	if err := s.RevokeRole(ctx, moderator, auth.RoleModerator); err != nil {
+		t.Errorf("revoking a lower user's role: %v", err)
+	}
+
+	// Moderators cannot raise anyone to their own level either
+	if err := s.GrantRole(WithActor(context.Background(), moderator), user, auth.RoleModerator); !errors.Is(err, ErrForbidden) {
+		t.Errorf("moderator granting moderator: expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestLastActiveAdminCannotBeDeleted(t *testing.T) {
+	admin, suspendedAdmin := uuid.New(), uuid.New()
+	roles := map[uuid.UUID][]string{admin: {auth.RoleAdmin}, suspendedAdmin: {auth.RoleAdmin}}
+	s := newAdminService(t, roles, 1)
+
+	// The admin CLI acts without an operator in ctx, so only the count applies
+	err := s.DeleteUser(context.Background(), suspendedAdmin)
+	if err != nil {
+		t.Errorf("deleting a suspended admin: %v", err)
+	}
+
+	active := newFakeService(t, Config{TokenSecret: "secret"}, map[string]func([]driver.Value) (any, error){
+		"GetUserByID":              func(args []driver.Value) (any, error) { return database.User{ID: admin}, nil },
+		"GetUserRoles":             func(args []driver.Value) (any, error) { return []string{auth.RoleAdmin}, nil },
+		"CountActiveUsersWithRole": func(args []driver.Value) (any, error) { return int64(1), nil },
+	})
+	err = active.DeleteUser(context.Background(), admin)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("deleting the last active admin: expected ErrConflict, got %v", err)
+	}
+}
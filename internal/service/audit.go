@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"main/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit event types
+const (
+	EventLoginSucceeded       = "login_succeeded"
+	EventLoginFailed          = "login_failed"
+	EventTokenRefreshed       = "token_refreshed"
+	EventTokenRevoked         = "token_revoked"
+	EventRefreshTokenReuse    = "refresh_token_reuse"
+	EventPasswordChanged      = "password_changed"
+	EventEmailChanged         = "email_changed"
+	EventPasswordReset        = "password_reset"
+	EventTwoFactorEnabled     = "two_factor_enabled"
+	EventTwoFactorDisabled    = "two_factor_disabled"
+	EventRecoveryCodeUsed     = "recovery_code_used"
+	EventIdentityLinked       = "identity_linked"
+	EventAppAuthorized        = "app_authorized"
+	EventPersonalTokenCreated = "personal_access_token_created"
+	EventLoginLocked          = "login_locked"
+	EventLoginUnlocked        = "login_unlocked"
+	EventRoleGranted          = "role_granted"
+	EventRoleRevoked          = "role_revoked"
+	EventUserSuspended        = "user_suspended"
+	EventUserUnsuspended      = "user_unsuspended"
+	EventForcedLogout         = "forced_logout"
+	EventChirpyRedGranted     = "chirpy_red_granted"
+	EventChirpyRedRevoked     = "chirpy_red_revoked"
+	EventUserDeleted          = "user_deleted"
+	EventUsersReset           = "users_reset"
+	EventWebhookReplayed      = "webhook_replayed"
+)
+
+// Free-form details stored with an audit event as JSON
+type AuditMetadata map[string]any
+
+type contextKey string
+
+const (
+	clientContextKey contextKey = "client"
+	actorContextKey  contextKey = "actor"
+)
+
+// Attach the client making a request, audit events record its IP and user agent
+func WithClient(ctx context.Context, client ClientInfo) context.Context {
+	return context.WithValue(ctx, clientContextKey, client)
+}
+
+// Attach the operator acting on other users' accounts, audit events record
+// them as the actor
+func WithActor(ctx context.Context, actorID uuid.UUID) context.Context {
+	return context.WithValue(ctx, actorContextKey, actorID)
+}
+
+// Record an event on a user's account, done by the operator in ctx or
+// otherwise by the user themselves
+func (s *Service) audit(ctx context.Context, eventType string, target uuid.UUID, metadata AuditMetadata) {
+	actor, ok := ctx.Value(actorContextKey).(uuid.UUID)
+	if !ok {
+		actor = target
+	}
+	s.recordAuditEvent(ctx, eventType, actor, target, metadata)
+}
+
+// Write an audit event, failures are logged but never block the request.
+// A nil actor is the system or an unauthenticated caller.
+func (s *Service) recordAuditEvent(ctx context.Context, eventType string, actor, target uuid.UUID, metadata AuditMetadata) {
+	if metadata == nil {
+		metadata = AuditMetadata{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("Error encoding audit metadata: %s", err)
+		return
+	}
+
+	client, _ := ctx.Value(clientContextKey).(ClientInfo)
+	err = s.queries.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		EventType: eventType,
+		ActorID:   uuid.NullUUID{UUID: actor, Valid: actor != uuid.Nil},
+		TargetID:  uuid.NullUUID{UUID: target, Valid: target != uuid.Nil},
+		Ip:        client.IP,
+		UserAgent: client.UserAgent,
+		Metadata:  encoded,
+	})
+	if err != nil {
+		log.Printf("Error writing audit event: %s", err)
+	}
+}
+
+type AuditFilter struct {
+	// Zero matches any actor or target
+	ActorID  uuid.UUID
+	TargetID uuid.UUID
+	// Empty matches every type
+	EventTypes []string
+	IP         string
+	// Zero leaves the range open
+	Since time.Time
+	Until time.Time
+	// From a previous page, empty for the first one
+	Cursor string
+	Limit  int
+}
+
+type AuditPage struct {
+	Events []database.AuditEvent
+	// Empty on the last page
+	NextCursor string
+}
+
+// Audit events matching the filter, newest first
+func (s *Service) ListAuditEvents(ctx context.Context, filter AuditFilter) (AuditPage, error) {
+	limit := pageSize(filter.Limit)
+
+	params := database.SearchAuditEventsParams{
+		ActorID:    uuid.NullUUID{UUID: filter.ActorID, Valid: filter.ActorID != uuid.Nil},
+		TargetID:   uuid.NullUUID{UUID: filter.TargetID, Valid: filter.TargetID != uuid.Nil},
+		EventTypes: filter.EventTypes,
+		Ip:         filter.IP,
+		Since:      sql.NullTime{Time: filter.Since.UTC(), Valid: !filter.Since.IsZero()},
+		Until:      sql.NullTime{Time: filter.Until.UTC(), Valid: !filter.Until.IsZero()},
+		PageSize:   int32(limit + 1),
+	}
+	if params.EventTypes == nil {
+		params.EventTypes = []string{}
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	events, err := s.queries.SearchAuditEvents(ctx, params)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	page := AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// Events on the user's own account, newest first
+func (s *Service) ListSecurityEvents(ctx context.Context, userID uuid.UUID, cursor string, limit int) (AuditPage, error) {
+	return s.ListAuditEvents(ctx, AuditFilter{TargetID: userID, Cursor: cursor, Limit: limit})
+}
+
+// The database refuses to delete younger audit events, shorter retention
+// settings are raised to this
+const MinAuditRetention = 30 * 24 * time.Hour
+
+// Delete audit events older than the retention period, zero keeps them forever
+func (s *Service) pruneAuditEvents(ctx context.Context) error {
+	if s.auditRetention <= 0 {
+		return nil
+	}
+
+	deleted, err := s.queries.DeleteAuditEventsBefore(ctx, time.Now().UTC().Add(-s.auditRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d audit events past retention", deleted)
+	}
+	return nil
+}
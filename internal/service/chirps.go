@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/internal/database"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+const MaxChirpLength = 140
+
+func (s *Service) CreateChirp(ctx context.Context, userID uuid.UUID, body string) (database.Chirp, error) {
+	if len(body) > MaxChirpLength {
+		return database.Chirp{}, fmt.Errorf("%w: chirp is longer than %d characters", ErrInvalid, MaxChirpLength)
+	}
+
+	if s.requireVerifiedEmail {
+		user, err := s.queries.GetUserByID(ctx, userID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		if !user.EmailVerifiedAt.Valid {
+			return database.Chirp{}, fmt.Errorf("%w: verify your email address before chirping", ErrForbidden)
+		}
+	}
+
+	chirp, err := s.queries.CreateChirp(ctx, database.CreateChirpParams{
+		Body:   body,
+		UserID: userID,
+	})
+	if err != nil {
+		return chirp, err
+	}
+
+	s.events.Publish(ChirpEvent{Type: ChirpCreated, Chirp: chirp})
+	return chirp, nil
+}
+
+func (s *Service) GetChirp(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.queries.GetChirpByID(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return chirp, ErrNotFound
+	}
+	return chirp, err
+}
+
+// List chirps, optionally by a single author, ordered by creation time
+func (s *Service) ListChirps(ctx context.Context, authorID uuid.NullUUID, descending bool) ([]database.Chirp, error) {
+	var chirps []database.Chirp
+	var err error
+	if authorID.Valid {
+		chirps, err = s.queries.GetUserChirps(ctx, authorID.UUID)
+	} else {
+		chirps, err = s.queries.GetChirps(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if descending {
+		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
+	} else {
+		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.Before(chirps[j].CreatedAt) })
+	}
+
+	return chirps, nil
+}
+
+// Delete a chirp owned by userID
+func (s *Service) DeleteChirp(ctx context.Context, userID, chirpID uuid.UUID) error {
+	chirp, err := s.GetChirp(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	if chirp.UserID != userID {
+		return ErrForbidden
+	}
+
+	err = s.queries.DeleteChirpByID(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	s.events.Publish(ChirpEvent{Type: ChirpDeleted, Chirp: chirp})
+	return nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"main/internal/database"
+	"main/internal/mailer"
+)
+
+// Answers sqlc queries by name so service logic can run without Postgres.
+// A handler returns a model struct or a slice of them for queries, the
+// number of affected rows for :exec and :execrows, or nil for no rows.
+type fakeDB struct {
+	mu       sync.Mutex
+	handlers map[string]func(args []driver.Value) (any, error)
+}
+
+func newFakeService(t *testing.T, cfg Config, handlers map[string]func(args []driver.Value) (any, error)) *Service {
+	t.Helper()
+	db := sql.OpenDB(&fakeDB{handlers: handlers})
+	t.Cleanup(func() { db.Close() })
+	if cfg.Mailer == nil {
+		cfg.Mailer = discardMailer{}
+	}
+	return New(database.New(db), cfg)
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return nil
+}
+
+func (db *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeConn{db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("fakedb: open through the connector")
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakedb: transactions are not supported")
+}
+
+func (c fakeConn) run(query string, named []driver.NamedValue) (any, error) {
+	// sqlc queries start with "-- name: <Name> :<kind>"
+	fields := strings.Fields(query)
+	if len(fields) < 3 || fields[1] != "name:" {
+		return nil, fmt.Errorf("fakedb: not a sqlc query: %q", query)
+	}
+	handler, ok := c.db.handlers[fields[2]]
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unexpected query %s", fields[2])
+	}
+
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return handler(args)
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	result, err := c.run(query, named)
+	if err != nil {
+		return nil, err
+	}
+	affected, _ := result.(int64)
+	return driver.RowsAffected(affected), nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.run(query, named)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &fakeRows{}
+	if result == nil {
+		return rows, nil
+	}
+	value := reflect.ValueOf(result)
+	if value.Kind() != reflect.Slice {
+		value = reflect.Append(reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1), value)
+	}
+	for i := 0; i < value.Len(); i++ {
+		row, err := fakeRow(value.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		rows.rows = append(rows.rows, row)
+	}
+	return rows, nil
+}
+
+// Column values of a model in field order, which is the order sqlc scans them
+func fakeRow(model reflect.Value) ([]driver.Value, error) {
+	if model.Kind() != reflect.Struct {
+		return []driver.Value{model.Interface()}, nil
+	}
+	row := make([]driver.Value, model.NumField())
+	for i := range row {
+		value, err := driver.DefaultParameterConverter.ConvertValue(model.Field(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("fakedb: field %s: %w", model.Type().Field(i).Name, err)
+		}
+		row[i] = value
+	}
+	return row, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"main/internal/database"
+	"main/internal/mailer"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Failed logins are counted per account and per client IP in Postgres so
+// every instance enforces the same lockouts
+type throttlePolicy struct {
+	// Failures allowed before logins are locked
+	threshold int32
+	// Lockout at the threshold, doubled by every failure after it
+	baseLockout time.Duration
+	maxLockout  time.Duration
+}
+
+var (
+	accountThrottle = throttlePolicy{threshold: 5, baseLockout: time.Minute, maxLockout: time.Hour}
+	// Looser, many users may share an address behind NAT
+	ipThrottle = throttlePolicy{threshold: 20, baseLockout: time.Minute, maxLockout: 15 * time.Minute}
+)
+
+// Counters start over once no failure was seen for this long
+const loginFailureWindow = 24 * time.Hour
+
+// How long logins stay locked after the given number of failures
+func (p throttlePolicy) lockout(failures int32) time.Duration {
+	if failures < p.threshold {
+		return 0
+	}
+	lockout := p.baseLockout
+	for i := p.threshold; i < failures && lockout < p.maxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.maxLockout)
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func loginThrottleKeys(email, ip string) []string {
+	keys := []string{accountThrottleKey(email)}
+	if ip != "" {
+		keys = append(keys, ipThrottleKey(ip))
+	}
+	return keys
+}
+
+// Refuse the login while the account or the client IP is locked, checked
+// before the password so a locked account reveals nothing about it
+func (s *Service) checkLoginThrottle(ctx context.Context, email, ip string) error {
+	locks, err := s.queries.GetActiveLoginLocks(ctx, loginThrottleKeys(email, ip))
+	if err != nil {
+		return err
+	}
+
+	var retryAfter time.Duration
+	for _, lock := range locks {
+		retryAfter = max(retryAfter, time.Until(lock.LockedUntil.Time))
+	}
+	if retryAfter > 0 {
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Count a failed login and lock the account or IP once it crosses its
+// threshold. user is the zero value when the email matches no account.
+func (s *Service) recordLoginFailure(ctx context.Context, email, ip string, user database.User) {
+	policies := map[string]throttlePolicy{accountThrottleKey(email): accountThrottle}
+	if ip != "" {
+		policies[ipThrottleKey(ip)] = ipThrottle
+	}
+
+	now := time.Now().UTC()
+	for key, policy := range policies {
+		throttle, err := s.queries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key:           key,
+			LastFailureAt: now.Add(-loginFailureWindow),
+		})
+		if err != nil {
+			log.Printf("Error recording failed login for %s: %s", key, err)
+			continue
+		}
+
+		lockout := policy.lockout(throttle.Failures)
+		if lockout == 0 {
+			continue
+		}
+
+		err = s.queries.LockLogin(ctx, database.LockLoginParams{
+			Key:         key,
+			LockedUntil: sql.NullTime{Time: now.Add(lockout), Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error locking logins for %s: %s", key, err)
+			continue
+		}
+
+		// Only the first lockout of a streak is reported, later ones just grow longer
+		if policy == accountThrottle && throttle.Failures == policy.threshold && user.ID != uuid.Nil {
+			s.notifyAccountLocked(ctx, user, ip, throttle.Failures, lockout)
+		}
+	}
+}
+
+// Forget the account's failures after a successful login, the IP counter
+// is kept so one valid account cannot reset it
+func (s *Service) clearLoginFailures(ctx context.Context, email string) {
+	err := s.queries.ClearLoginThrottle(ctx, accountThrottleKey(email))
+	if err != nil {
+		log.Printf("Error clearing failed logins: %s", err)
+	}
+}
+
+func (s *Service) notifyAccountLocked(ctx context.Context, user database.User, ip string, failures int32, lockout time.Duration) {
+	s.recordAuditEvent(ctx, EventLoginLocked, uuid.Nil, user.ID, AuditMetadata{
+		"failures":        failures,
+		"lockout_seconds": int(lockout.Seconds()),
+	})
+
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account was locked",
+		Body: fmt.Sprintf("We locked logins to %s for %d minutes after %d failed login attempts, the last one from %s.\n\nIf this wasn't you, someone may be guessing your password. Consider resetting it once the lock ends.\n",
+			user.Email, int(lockout.Minutes()), failures, ip),
+	})
+	if err != nil {
+		log.Printf("Error sending lockout email to %s: %s", user.Email, err)
+	}
+}
+
+// Lift a lockout on a user's account before it expires
+func (s *Service) UnlockLogin(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.queries.ClearLoginThrottle(ctx, accountThrottleKey(user.Email))
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventLoginUnlocked, user.ID, nil)
+	return nil
+}
+
+// Drop counters that have gone quiet and are not locking anything
+func (s *Service) pruneLoginThrottles(ctx context.Context) error {
+	return s.queries.DeleteStaleLoginThrottles(ctx, time.Now().UTC().Add(-loginFailureWindow))
+}
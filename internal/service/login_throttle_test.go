@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/auth"
+	"main/internal/database"
+
+	"github.com/google/uuid"
+)
+
+func TestWrongSecondFactorsLockLogin(t *testing.T) {
+	const email = "alice@example.com"
+	const password = "correct horse battery staple"
+
+	hashed, err := auth.DefaultPasswordHashing.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := database.User{
+		ID:             uuid.New(),
+		Email:          email,
+		HashedPassword: hashed,
+		TotpSecret:     sql.NullString{String: secret, Valid: true},
+		TotpEnabledAt:  sql.NullTime{Time: time.Now(), Valid: true},
+	}
+	wrongCode := "000000"
+	if _, ok := auth.ValidateTOTP(secret, wrongCode, time.Now()); ok {
+		wrongCode = "000001"
+	}
+
+	throttles := map[string]database.LoginThrottle{}
+	challenges := map[string]database.LoginChallenge{}
+	s := newFakeService(t, Config{TokenSecret: "secret"}, map[string]func([]driver.Value) (any, error){
+		"GetUserByEmail": func(args []driver.Value) (any, error) { return user, nil },
+		"GetUserByID":    func(args []driver.Value) (any, error) { return user, nil },
+		"GetActiveLoginLocks": func(args []driver.Value) (any, error) {
+			var locks []database.LoginThrottle
+			for key, throttle := range throttles {
+				if strings.Contains(args[0].(string), `"`+key+`"`) && throttle.LockedUntil.Time.After(time.Now()) {
+					locks = append(locks, throttle)
+				}
+			}
+			return locks, nil
+		},
+		"RecordLoginFailure": func(args []driver.Value) (any, error) {
+			throttle := throttles[args[0].(string)]
+			throttle.Key = args[0].(string)
+			throttle.Failures++
+			throttle.LastFailureAt = time.Now()
+			throttles[throttle.Key] = throttle
+			return throttle, nil
+		},
+		"LockLogin": func(args []driver.Value) (any, error) {
+			throttle := throttles[args[0].(string)]
+			throttle.LockedUntil = sql.NullTime{Time: args[1].(time.Time), Valid: true}
+			throttles[args[0].(string)] = throttle
+			return int64(1), nil
+		},
+		"ClearLoginThrottle": func(args []driver.Value) (any, error) {
+			delete(throttles, args[0].(string))
+			return int64(1), nil
+		},
+		"CreateLoginChallenge": func(args []driver.Value) (any, error) {
+			challenge := database.LoginChallenge{ID: uuid.New(), UserID: user.ID, ExpiresAt: args[1].(time.Time)}
+			challenges[challenge.ID.String()] = challenge
+			return challenge, nil
+		},
+		"AttemptLoginChallenge": func(args []driver.Value) (any, error) {
+			challenge, ok := challenges[args[0].(string)]
+			if !ok || int64(challenge.Attempts) >= args[1].(int64) {
+				return nil, nil
+			}
+			challenge.Attempts++
+			challenges[args[0].(string)] = challenge
+			return challenge, nil
+		},
+		"UseRecoveryCode":  func(args []driver.Value) (any, error) { return int64(0), nil },
+		"CreateAuditEvent": func(args []driver.Value) (any, error) { return int64(1), nil },
+	})
+
+	ctx := context.Background()
+	client := ClientInfo{IP: "192.0.2.1"}
+
+	// One wrong code per challenge, each challenge from a fresh password login
+	for i := int32(0); i < accountThrottle.threshold; i++ {
+		result, err := s.Login(ctx, email, password, client)
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if result.ChallengeToken == "" {
+			t.Fatalf("login %d: expected a two-factor challenge", i)
+		}
+
+		_, err = s.CompleteTwoFactorLogin(ctx, result.ChallengeToken, wrongCode, client)
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("challenge %d: expected ErrUnauthorized, got %v", i, err)
+		}
+	}
+
+	_, err = s.Login(ctx, email, password, client)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected the account to be locked after repeated wrong codes, got %v", err)
+	}
+}
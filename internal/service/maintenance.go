@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Periodic cleanup of expired rows, safe to run on every instance
+func (s *Service) RunMaintenance(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.pruneLoginThrottles(ctx)
+			if err != nil {
+				log.Printf("Error pruning login throttles: %s", err)
+			}
+
+			err = s.pruneAuditEvents(ctx)
+			if err != nil {
+				log.Printf("Error pruning audit events: %s", err)
+			}
+
+			err = s.pruneWebhookDeliveries(ctx)
+			if err != nil {
+				log.Printf("Error pruning webhook deliveries: %s", err)
+			}
+
+			err = s.expireSubscriptions(ctx)
+			if err != nil {
+				log.Printf("Error expiring subscriptions: %s", err)
+			}
+		}
+	}
+}
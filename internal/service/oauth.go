@@ -0,0 +1,418 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const oauthCodeLifetime = time.Minute
+
+// Error codes from RFC 6749 that clients expect in the error parameter
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+)
+
+// Failure reported to an OAuth client, matches ErrUnauthorized for client
+// authentication failures and ErrInvalid otherwise
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func (e *OAuthError) Is(target error) bool {
+	if e.Code == OAuthInvalidClient {
+		return target == ErrUnauthorized
+	}
+	return target == ErrInvalid
+}
+
+func oauthError(code, format string, args ...any) error {
+	return &OAuthError{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+type AppParams struct {
+	Name        string
+	RedirectURI string
+	// Confidential apps get a client secret, public apps rely on PKCE alone
+	Confidential bool
+}
+
+// Redirect URIs must be https, or http on the loopback interface for local development
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || parsed.Host == "" || parsed.Fragment != "" {
+		return fmt.Errorf("%w: redirect_uri must be an absolute URL without a fragment", ErrInvalid)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := parsed.Hostname()
+		if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: redirect_uri must use https", ErrInvalid)
+}
+
+// Register an app, returning its client secret once for confidential apps
+func (s *Service) RegisterApp(ctx context.Context, ownerID uuid.UUID, params AppParams) (database.OauthApp, string, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > 100 {
+		return database.OauthApp{}, "", fmt.Errorf("%w: name must be 1-100 characters", ErrInvalid)
+	}
+
+	err := validateRedirectURI(params.RedirectURI)
+	if err != nil {
+		return database.OauthApp{}, "", err
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			return database.OauthApp{}, "", err
+		}
+		secretHash = sql.NullString{String: auth.HashRefreshToken(secret), Valid: true}
+	}
+
+	app, err := s.queries.CreateOauthApp(ctx, database.CreateOauthAppParams{
+		OwnerID:          ownerID,
+		Name:             name,
+		RedirectUri:      params.RedirectURI,
+		ClientSecretHash: secretHash,
+	})
+	if err != nil {
+		return database.OauthApp{}, "", err
+	}
+
+	return app, secret, nil
+}
+
+func (s *Service) ListApps(ctx context.Context, ownerID uuid.UUID) ([]database.OauthApp, error) {
+	return s.queries.GetUserOauthApps(ctx, ownerID)
+}
+
+// Delete an app, ending every session granted to it
+func (s *Service) DeleteApp(ctx context.Context, ownerID, appID uuid.UUID) error {
+	deleted, err := s.queries.DeleteUserOauthApp(ctx, database.DeleteUserOauthAppParams{
+		ID:      appID,
+		OwnerID: ownerID,
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) getApp(ctx context.Context, clientID string) (database.OauthApp, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthApp{}, oauthError(OAuthInvalidClient, "unknown client_id")
+	}
+
+	app, err := s.queries.GetOauthApp(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthApp{}, oauthError(OAuthInvalidClient, "unknown client_id")
+	}
+	return app, err
+}
+
+// Client credentials from HTTP basic auth or the request body
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+func (s *Service) authenticateClient(ctx context.Context, creds ClientCredentials) (database.OauthApp, error) {
+	app, err := s.getApp(ctx, creds.ClientID)
+	if err != nil {
+		return database.OauthApp{}, err
+	}
+
+	if app.ClientSecretHash.Valid {
+		digest := auth.HashRefreshToken(creds.ClientSecret)
+		if subtle.ConstantTimeCompare([]byte(digest), []byte(app.ClientSecretHash.String)) != 1 {
+			return database.OauthApp{}, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+	}
+
+	return app, nil
+}
+
+// Parameters of an authorization request
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// A validated authorization request, shown on the consent screen
+type AuthorizationDetails struct {
+	App    database.OauthApp
+	Scopes []string
+	State  string
+	// Set once the client and redirect URI are trusted, so later errors
+	// may be sent back to the client rather than shown to the user
+	RedirectURI string
+}
+
+// Redirect back to the client with the parameters and the request's state
+func (d AuthorizationDetails) Redirect(params url.Values) string {
+	if d.State != "" {
+		params.Set("state", d.State)
+	}
+
+	separator := "?"
+	if strings.Contains(d.RedirectURI, "?") {
+		separator = "&"
+	}
+	return d.RedirectURI + separator + params.Encode()
+}
+
+func (s *Service) ValidateAuthorization(ctx context.Context, req AuthorizationRequest) (AuthorizationDetails, error) {
+	details := AuthorizationDetails{State: req.State}
+
+	app, err := s.getApp(ctx, req.ClientID)
+	if err != nil {
+		return details, err
+	}
+	details.App = app
+
+	if req.RedirectURI != "" && req.RedirectURI != app.RedirectUri {
+		return details, oauthError(OAuthInvalidRequest, "redirect_uri does not match the registered one")
+	}
+	details.RedirectURI = app.RedirectUri
+
+	if req.ResponseType != "code" {
+		return details, oauthError(OAuthUnsupportedResponseType, "only the code response type is supported")
+	}
+
+	details.Scopes, err = auth.ParseScopes(req.Scope)
+	if err != nil {
+		return details, oauthError(OAuthInvalidScope, "%s", err)
+	}
+
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return details, oauthError(OAuthInvalidRequest, "PKCE with the S256 method is required")
+	}
+
+	return details, nil
+}
+
+// Record the user's answer on the consent screen, returning where to send them
+func (s *Service) AuthorizeApp(ctx context.Context, userID uuid.UUID, req AuthorizationRequest, approve bool) (string, error) {
+	details, err := s.ValidateAuthorization(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if !approve {
+		return details.Redirect(url.Values{"error": {OAuthAccessDenied}}), nil
+	}
+
+	stored, err := s.queries.CreateOauthCode(ctx, database.CreateOauthCodeParams{
+		AppID:         details.App.ID,
+		UserID:        userID,
+		RedirectUri:   details.RedirectURI,
+		Scopes:        strings.Join(details.Scopes, " "),
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.audit(ctx, EventAppAuthorized, userID, AuditMetadata{
+		"app_id":   details.App.ID,
+		"app_name": details.App.Name,
+		"scopes":   stored.Scopes,
+	})
+
+	code := s.signedToken(purposeOAuthCode, stored.ID)
+	return details.Redirect(url.Values{"code": {code}}), nil
+}
+
+// Tokens returned from the token endpoint
+type TokenResult struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	Scope        string
+}
+
+func verifyCodeChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// Redeem an authorization code, starting a session limited to the granted scopes
+func (s *Service) ExchangeAuthorizationCode(ctx context.Context, creds ClientCredentials, code, redirectURI, verifier string, client ClientInfo) (TokenResult, error) {
+	app, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	id, err := s.parseSignedToken(purposeOAuthCode, code)
+	if err != nil {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "malformed code")
+	}
+
+	stored, err := s.queries.UseOauthCode(ctx, database.UseOauthCodeParams{
+		ID:    id,
+		AppID: app.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "code expired, already used or issued to another client")
+	}
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	if redirectURI != stored.RedirectUri {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !verifyCodeChallenge(verifier, stored.CodeChallenge) {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	err = s.checkSuspended(ctx, stored.UserID)
+	if errors.Is(err, ErrForbidden) || errors.Is(err, ErrUnauthorized) {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "%s", err)
+	}
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	session, err := s.queries.CreateAppSession(ctx, database.CreateAppSessionParams{
+		UserID:    stored.UserID,
+		UserAgent: client.UserAgent,
+		Ip:        client.IP,
+		AppID:     uuid.NullUUID{UUID: app.ID, Valid: true},
+		Scopes:    stored.Scopes,
+	})
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	token, err := s.sessionJWT(session, nil)
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, stored.UserID, session.ID)
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	return TokenResult{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.accessTokenLifetime,
+		Scope:        session.Scopes,
+	}, nil
+}
+
+// Find the app session a refresh token belongs to
+func (s *Service) appSessionForRefreshToken(ctx context.Context, app database.OauthApp, refreshToken string) (database.Session, error) {
+	stored, err := s.queries.GetRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	session, err := s.queries.GetSessionByID(ctx, stored.FamilyID)
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	if !session.AppID.Valid || session.AppID.UUID != app.ID {
+		return database.Session{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+// Rotate an app's refresh token, the scopes stay those originally granted
+func (s *Service) RefreshAppToken(ctx context.Context, creds ClientCredentials, refreshToken string) (TokenResult, error) {
+	app, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	session, err := s.appSessionForRefreshToken(ctx, app, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "unknown refresh token")
+	}
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	refreshed, err := s.RefreshAccessToken(ctx, refreshToken)
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+		return TokenResult{}, oauthError(OAuthInvalidGrant, "%s", err)
+	}
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	return TokenResult{
+		AccessToken:  refreshed.Token,
+		RefreshToken: refreshed.RefreshToken,
+		ExpiresIn:    s.accessTokenLifetime,
+		Scope:        session.Scopes,
+	}, nil
+}
+
+// Revoke the session behind an app's access or refresh token. Unknown tokens
+// are not an error, so clients learn nothing about tokens they don't own.
+func (s *Service) RevokeAppToken(ctx context.Context, creds ClientCredentials, token string) error {
+	app, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.appSessionForRefreshToken(ctx, app, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		claims, parseErr := s.keys.ParseJWT(token)
+		if parseErr != nil || claims.ClientID != app.ID {
+			return nil
+		}
+		return s.revokeSessionByID(ctx, claims.SessionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionByID(ctx, session.ID)
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/oidc"
+	"time"
+)
+
+// How long a started login may take to come back from the provider
+const OIDCLoginLifetime = 10 * time.Minute
+
+func (s *Service) oidcProvider(name string) (*oidc.Provider, error) {
+	provider, ok := s.oidcProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown provider %q", ErrNotFound, name)
+	}
+	return provider, nil
+}
+
+// Start a login with an external provider and return the URL to redirect to
+// and its state. The nonce and PKCE verifier stay in the database, the state
+// names their row. Callers bind the state to the browser that started the
+// login, the callback must come back to the same browser.
+func (s *Service) BeginOIDCLogin(ctx context.Context, providerName string) (url, state string, err error) {
+	provider, err := s.oidcProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	pending, err := s.queries.CreateOidcLogin(ctx, database.CreateOidcLoginParams{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: oidc.GenerateVerifier(),
+		ExpiresAt:    time.Now().UTC().Add(OIDCLoginLifetime),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	state = s.signedToken(purposeOIDCState, pending.ID)
+	url, err = provider.AuthCodeURL(ctx, state, pending.Nonce, pending.CodeVerifier)
+	return url, state, err
+}
+
+// Finish a login from the provider's callback. The state is single use, and
+// the account is found by linked identity, then by an email both sides have
+// verified, or created.
+func (s *Service) CompleteOIDCLogin(ctx context.Context, providerName, code, state string, client ClientInfo) (LoginResult, error) {
+	provider, err := s.oidcProvider(providerName)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	id, err := s.parseSignedToken(purposeOIDCState, state)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	pending, err := s.queries.UseOidcLogin(ctx, database.UseOidcLoginParams{
+		ID:       id,
+		Provider: providerName,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginResult{}, fmt.Errorf("%w: login expired or already used", ErrUnauthorized)
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	identity, err := provider.Exchange(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+
+	user, err := s.userForIdentity(ctx, providerName, identity)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if user.TotpEnabledAt.Valid {
+		return s.createLoginChallenge(ctx, user)
+	}
+
+	return s.startSession(ctx, user, client)
+}
+
+func (s *Service) userForIdentity(ctx context.Context, providerName string, identity oidc.Identity) (database.User, error) {
+	linked, err := s.queries.GetIdentity(ctx, database.GetIdentityParams{
+		Provider: providerName,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		err = s.queries.TouchIdentity(ctx, database.TouchIdentityParams{
+			ID:    linked.ID,
+			Email: identity.Email,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		return s.queries.GetUserByID(ctx, linked.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	// Linking by an unverified address would let anyone claim an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return database.User{}, fmt.Errorf("%w: provider did not return a verified email address", ErrForbidden)
+	}
+
+	user, err := s.queries.GetUserByEmail(ctx, identity.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = s.createOIDCUser(ctx, identity.Email)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	// Whoever registered an unverified address may not own it, linking
+	// would hand the owner's provider login to their account
+	if !user.EmailVerifiedAt.Valid {
+		return database.User{}, fmt.Errorf("%w: verify the email address of the existing account before signing in with %s", ErrConflict, providerName)
+	}
+
+	_, err = s.queries.CreateIdentity(ctx, database.CreateIdentityParams{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	s.audit(ctx, EventIdentityLinked, user.ID, AuditMetadata{"provider": providerName, "subject": identity.Subject})
+	return user, nil
+}
+
+// Users created from a provider get a random password until they reset it
+func (s *Service) createOIDCUser(ctx context.Context, email string) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	hashed, err := s.passwords.Hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := s.queries.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashed,
+	})
+	if err != nil {
+		return database.User{}, uniqueConflict(err)
+	}
+
+	return s.queries.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{
+		ID:    user.ID,
+		Email: email,
+	})
+}
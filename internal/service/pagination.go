@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// Page size for a requested limit, zero or less takes the default
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	return min(limit, maxPageSize)
+}
+
+// Opaque position in a list ordered by creation time, newest first
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalid)
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	timePart, idPart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	return createdAt, id, nil
+}
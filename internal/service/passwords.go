@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/database"
+	"main/internal/mailer"
+	"net/url"
+	"time"
+)
+
+const (
+	passwordResetLifetime = time.Hour
+	// Reset emails per account per hour, further requests are dropped silently
+	passwordResetsPerHour = 3
+)
+
+// Email a password reset link if the address belongs to an account. The
+// outcome is never reported, so callers cannot probe for registered emails.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) {
+	user, err := s.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting user for password reset: %s", err)
+		}
+		return
+	}
+
+	recent, err := s.queries.CountRecentPasswordResets(ctx, database.CountRecentPasswordResetsParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC().Add(-time.Hour),
+	})
+	if err != nil {
+		log.Printf("Error counting password resets: %s", err)
+		return
+	}
+	if recent >= passwordResetsPerHour {
+		log.Printf("Dropping password reset request for user %s, too many recent requests", user.ID)
+		return
+	}
+
+	reset, err := s.queries.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetLifetime),
+	})
+	if err != nil {
+		log.Printf("Error creating password reset: %s", err)
+		return
+	}
+
+	link := s.baseURL + "/app/reset.html?token=" + url.QueryEscape(s.signedToken(purposePasswordReset, reset.ID))
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for %s. Choose a new password within %d minutes using this link:\n\n%s\n\nIf this wasn't you, you can ignore this email and your password will stay the same.\n",
+			user.Email, int(passwordResetLifetime.Minutes()), link),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email to %s: %s", user.Email, err)
+	}
+}
+
+// Set a new password with a reset token and log out every session
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	id, err := s.parseSignedToken(purposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := s.hashNewPassword(password)
+	if err != nil {
+		return err
+	}
+
+	reset, err := s.queries.UsePasswordReset(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: reset link expired or already used", ErrInvalid)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.queries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		HashedPassword: hashed,
+		ID:             reset.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.queries.ExpireUserPasswordResets(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = s.RevokeAllSessions(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventPasswordReset, reset.UserID, AuditMetadata{"method": "email_link", "sessions_revoked": true})
+	return nil
+}
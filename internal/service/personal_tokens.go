@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PersonalTokenParams struct {
+	Name   string
+	Scopes []string
+	// Nil means the token never expires
+	ExpiresAt *time.Time
+}
+
+// Create a personal access token, the token itself is only returned here
+func (s *Service) CreatePersonalAccessToken(ctx context.Context, userID uuid.UUID, params PersonalTokenParams) (database.PersonalAccessToken, string, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > 100 {
+		return database.PersonalAccessToken{}, "", fmt.Errorf("%w: name must be 1-100 characters", ErrInvalid)
+	}
+
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		return database.PersonalAccessToken{}, "", fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			return database.PersonalAccessToken{}, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalid)
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		return database.PersonalAccessToken{}, "", err
+	}
+
+	stored, err := s.queries.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: auth.HashRefreshToken(token),
+		TokenHint: token[:len(auth.PersonalAccessTokenPrefix)+4],
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return database.PersonalAccessToken{}, "", err
+	}
+
+	s.audit(ctx, EventPersonalTokenCreated, userID, AuditMetadata{
+		"token_id": stored.ID,
+		"name":     stored.Name,
+		"scopes":   stored.Scopes,
+	})
+	return stored, token, nil
+}
+
+func (s *Service) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	return s.queries.GetUserPersonalAccessTokens(ctx, userID)
+}
+
+func (s *Service) RevokePersonalAccessToken(ctx context.Context, userID, tokenID uuid.UUID) error {
+	revoked, err := s.queries.RevokeUserPersonalAccessToken(ctx, database.RevokeUserPersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) authenticatePersonalToken(ctx context.Context, token string) (auth.Claims, error) {
+	stored, err := s.queries.UsePersonalAccessToken(ctx, auth.HashRefreshToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.Claims{}, fmt.Errorf("%w: personal access token expired or revoked", ErrUnauthorized)
+	}
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	return auth.Claims{
+		UserID:          stored.UserID,
+		PersonalTokenID: stored.ID,
+		Scopes:          strings.Fields(stored.Scopes),
+	}, nil
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/database"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	providerPolka = "polka"
+
+	PolkaSignatureHeader = "Polka-Signature"
+
+	PolkaUserUpgraded   = "user.upgraded"
+	PolkaUserRenewed    = "user.renewed"
+	PolkaUserDowngraded = "user.downgraded"
+	PolkaPaymentFailed  = "user.payment_failed"
+	PolkaUserCancelled  = "user.cancelled"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryReceived  = "received"
+	DeliveryRejected  = "rejected"
+	DeliveryInvalid   = "invalid"
+	DeliveryProcessed = "processed"
+	DeliveryDuplicate = "duplicate"
+	DeliveryFailed    = "failed"
+)
+
+// A verified delivery from Polka
+type PolkaEvent struct {
+	// Polka's ID for the event, the same across redeliveries
+	ID     string
+	Type   string
+	UserID uuid.UUID
+	// When Polka created the event, zero for now
+	CreatedAt time.Time
+	// Subscription details, zero when the event leaves them unchanged
+	SubscriptionID   string
+	Plan             string
+	CurrentPeriodEnd time.Time
+}
+
+func parsePolkaEvent(body []byte) (PolkaEvent, error) {
+	type parameters struct {
+		ID        string     `json:"id"`
+		Event     string     `json:"event"`
+		CreatedAt *time.Time `json:"created_at"`
+		Data      struct {
+			UserID           string     `json:"user_id"`
+			SubscriptionID   string     `json:"subscription_id"`
+			Plan             string     `json:"plan"`
+			CurrentPeriodEnd *time.Time `json:"current_period_end"`
+		} `json:"data"`
+	}
+
+	params := parameters{}
+	err := json.Unmarshal(body, &params)
+	if err != nil {
+		return PolkaEvent{}, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	if params.ID == "" {
+		return PolkaEvent{}, fmt.Errorf("%w: event id is required", ErrInvalid)
+	}
+
+	event := PolkaEvent{
+		ID:             params.ID,
+		Type:           params.Event,
+		SubscriptionID: params.Data.SubscriptionID,
+		Plan:           params.Data.Plan,
+	}
+	if params.Data.UserID != "" {
+		event.UserID, err = uuid.Parse(params.Data.UserID)
+		if err != nil {
+			return event, fmt.Errorf("%w: user id: %s", ErrInvalid, err)
+		}
+	}
+	if params.CreatedAt != nil {
+		event.CreatedAt = *params.CreatedAt
+	}
+	if params.Data.CurrentPeriodEnd != nil {
+		event.CurrentPeriodEnd = *params.Data.CurrentPeriodEnd
+	}
+	return event, nil
+}
+
+// Store a Polka webhook request as received, then apply it if verified.
+// Rejected requests are kept only in part. The returned delivery records
+// the outcome.
+func (s *Service) ReceivePolkaWebhook(ctx context.Context, header http.Header, body []byte) (database.WebhookDelivery, error) {
+	verifyErr := s.polkaWebhooks.Verify(header.Get(PolkaSignatureHeader), body, time.Now())
+
+	stored := storedHeaders(header)
+	if verifyErr != nil {
+		stored = rejectedHeaders(header)
+		body = body[:min(len(body), maxRejectedBodyBytes)]
+	}
+	headers, err := json.Marshal(stored)
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+
+	delivery, err := s.queries.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+		Provider: providerPolka,
+		Headers:  headers,
+		Body:     body,
+	})
+	if err != nil {
+		return delivery, err
+	}
+
+	if verifyErr != nil {
+		delivery = s.finishDelivery(ctx, delivery, DeliveryRejected, false, PolkaEvent{}, verifyErr)
+		return delivery, fmt.Errorf("%w: %s", ErrUnauthorized, verifyErr)
+	}
+
+	return s.processPolkaDelivery(ctx, delivery)
+}
+
+// Headers kept with a delivery, without credentials
+func storedHeaders(header http.Header) http.Header {
+	stored := header.Clone()
+	stored.Del("Authorization")
+	stored.Del("Cookie")
+	return stored
+}
+
+// Anyone can send a rejected request, so only enough of it is kept to see
+// what was sent and replay a small one after fixing the webhook secrets
+const maxRejectedBodyBytes = 4 << 10
+
+var rejectedHeaderNames = []string{"Content-Type", "User-Agent", PolkaSignatureHeader}
+
+func rejectedHeaders(header http.Header) http.Header {
+	stored := http.Header{}
+	for _, name := range rejectedHeaderNames {
+		if value := header.Get(name); value != "" {
+			stored.Set(name, value[:min(len(value), 512)])
+		}
+	}
+	return stored
+}
+
+// Rejected deliveries are dropped sooner than the rest
+const RejectedDeliveryRetention = 7 * 24 * time.Hour
+
+func (s *Service) pruneWebhookDeliveries(ctx context.Context) error {
+	now := time.Now().UTC()
+	rejectedRetention := RejectedDeliveryRetention
+	if s.webhookRetention > 0 && s.webhookRetention < rejectedRetention {
+		rejectedRetention = s.webhookRetention
+	}
+
+	deleted, err := s.queries.DeleteRejectedWebhookDeliveriesBefore(ctx, now.Add(-rejectedRetention))
+	if err != nil {
+		return err
+	}
+	if s.webhookRetention > 0 {
+		more, err := s.queries.DeleteWebhookDeliveriesBefore(ctx, now.Add(-s.webhookRetention))
+		if err != nil {
+			return err
+		}
+		deleted += more
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d webhook deliveries past retention", deleted)
+	}
+	return nil
+}
+
+// Parse and apply a verified delivery
+func (s *Service) processPolkaDelivery(ctx context.Context, delivery database.WebhookDelivery) (database.WebhookDelivery, error) {
+	event, err := parsePolkaEvent(delivery.Body)
+	if err != nil {
+		return s.finishDelivery(ctx, delivery, DeliveryInvalid, true, event, err), err
+	}
+
+	duplicate, err := s.handlePolkaEvent(ctx, event)
+	status := DeliveryProcessed
+	switch {
+	case err != nil:
+		status = DeliveryFailed
+	case duplicate:
+		status = DeliveryDuplicate
+	}
+	return s.finishDelivery(ctx, delivery, status, true, event, err), err
+}
+
+// Record how a delivery was handled, failures to do so are only logged
+func (s *Service) finishDelivery(ctx context.Context, delivery database.WebhookDelivery, status string, verified bool, event PolkaEvent, cause error) database.WebhookDelivery {
+	params := database.FinishWebhookDeliveryParams{
+		ID:        delivery.ID,
+		Status:    status,
+		Verified:  verified,
+		EventID:   event.ID,
+		EventType: event.Type,
+	}
+	if cause != nil {
+		params.Error = cause.Error()
+	}
+
+	finished, err := s.queries.FinishWebhookDelivery(ctx, params)
+	if err != nil {
+		log.Printf("Error recording outcome of webhook delivery %s: %s", delivery.ID, err)
+		return delivery
+	}
+	return finished
+}
+
+// Apply a Polka event once. A redelivery of a processed event reports
+// duplicate and changes nothing, one arriving while another delivery holds
+// the event's claim is refused with ErrConflict so Polka retries it later.
+func (s *Service) handlePolkaEvent(ctx context.Context, event PolkaEvent) (duplicate bool, err error) {
+	claimed, err := s.queries.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+		Provider:  providerPolka,
+		EventID:   event.ID,
+		EventType: event.Type,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err := s.queries.GetWebhookEvent(ctx, database.GetWebhookEventParams{
+			Provider: providerPolka,
+			EventID:  event.ID,
+		})
+		if err != nil {
+			return false, err
+		}
+		if existing.ProcessedAt.Valid {
+			return true, nil
+		}
+		return false, fmt.Errorf("%w: event %s is being processed by another delivery", ErrConflict, event.ID)
+	}
+	if err != nil {
+		return false, err
+	}
+	if claimed.Attempts > 1 {
+		log.Printf("Retrying Polka event %s, attempt %d", event.ID, claimed.Attempts)
+	}
+
+	err = s.applySubscriptionEvent(ctx, event)
+	if err != nil {
+		// Left unprocessed so a redelivery tries again straight away
+		releaseErr := s.queries.ReleaseWebhookEventClaim(ctx, database.ReleaseWebhookEventClaimParams{
+			Provider: providerPolka,
+			EventID:  event.ID,
+		})
+		if releaseErr != nil {
+			log.Printf("Error releasing Polka event %s: %s", event.ID, releaseErr)
+		}
+		return false, err
+	}
+
+	err = s.queries.MarkWebhookEventProcessed(ctx, database.MarkWebhookEventProcessedParams{
+		Provider: providerPolka,
+		EventID:  event.ID,
+	})
+	return false, err
+}
+
+type WebhookDeliveryFilter struct {
+	// Empty matches every status or event
+	Status  string
+	EventID string
+	// From a previous page, empty for the first one
+	Cursor string
+	Limit  int
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []database.WebhookDelivery
+	// Empty on the last page
+	NextCursor string
+}
+
+// Stored Polka deliveries, newest first
+func (s *Service) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) (WebhookDeliveryPage, error) {
+	limit := pageSize(filter.Limit)
+
+	params := database.SearchWebhookDeliveriesParams{
+		Provider: providerPolka,
+		Status:   filter.Status,
+		EventID:  filter.EventID,
+		PageSize: int32(limit + 1),
+	}
+	if filter.Cursor != "" {
+		receivedAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return WebhookDeliveryPage{}, err
+		}
+		params.BeforeReceivedAt = sql.NullTime{Time: receivedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	deliveries, err := s.queries.SearchWebhookDeliveries(ctx, params)
+	if err != nil {
+		return WebhookDeliveryPage{}, err
+	}
+
+	page := WebhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		page.Deliveries = deliveries[:limit]
+		last := page.Deliveries[limit-1]
+		page.NextCursor = encodeCursor(last.ReceivedAt, last.ID)
+	}
+	return page, nil
+}
+
+func (s *Service) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	delivery, err := s.queries.GetWebhookDelivery(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return delivery, ErrNotFound
+	}
+	return delivery, err
+}
+
+// Run a stored delivery through the current handler logic again. A delivery
+// that was never verified must carry a signature valid when it was received.
+// An event already processed is reported as a duplicate unless force
+// applies it again. The outcome is recorded on the returned delivery.
+func (s *Service) ReplayWebhookDelivery(ctx context.Context, id uuid.UUID, force bool) (database.WebhookDelivery, error) {
+	delivery, err := s.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		return delivery, err
+	}
+
+	if !delivery.Verified {
+		var header http.Header
+		err = json.Unmarshal(delivery.Headers, &header)
+		if err != nil {
+			return delivery, err
+		}
+		err = s.polkaWebhooks.Verify(header.Get(PolkaSignatureHeader), delivery.Body, delivery.ReceivedAt)
+		if err != nil {
+			return delivery, fmt.Errorf("%w: %s", ErrConflict, err)
+		}
+	}
+
+	if force {
+		event, err := parsePolkaEvent(delivery.Body)
+		if err == nil {
+			err = s.queries.ReleaseWebhookEvent(ctx, database.ReleaseWebhookEventParams{
+				Provider: providerPolka,
+				EventID:  event.ID,
+			})
+			if err != nil {
+				return delivery, err
+			}
+		}
+	}
+
+	err = s.queries.CountWebhookReplay(ctx, delivery.ID)
+	if err != nil {
+		return delivery, err
+	}
+
+	replayed, err := s.processPolkaDelivery(ctx, delivery)
+	if err != nil {
+		log.Printf("Replay of webhook delivery %s failed: %s", delivery.ID, err)
+	}
+	s.audit(ctx, EventWebhookReplayed, uuid.Nil, AuditMetadata{
+		"delivery_id": delivery.ID,
+		"event_id":    replayed.EventID,
+		"force":       force,
+		"status":      replayed.Status,
+	})
+	return replayed, nil
+}
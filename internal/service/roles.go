@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Roles carried in the user's access tokens, always including the user role
+func (s *Service) userRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	roles, err := s.queries.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{auth.RoleUser}, roles...), nil
+}
+
+// Check that the roles in the token grant a permission. Role changes take
+// effect when the token is refreshed, revoking a role also ends the user's sessions.
+func (s *Service) RequirePermission(ctx context.Context, claims auth.Claims, permission string) error {
+	if len(claims.Roles) == 0 {
+		return fmt.Errorf("%w: token carries no roles", ErrForbidden)
+	}
+
+	permissions, err := s.queries.GetPermissionsForRoles(ctx, claims.Roles)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(permissions, permission) {
+		return fmt.Errorf("%w: roles %v lack permission %s", ErrForbidden, claims.Roles, permission)
+	}
+	return nil
+}
+
+// Give a user a role. Operators may only grant roles ranking below their
+// own, to users they outrank.
+func (s *Service) GrantRole(ctx context.Context, userID uuid.UUID, role string) error {
+	err := s.validateRole(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkGrantable(ctx, role)
+	if err != nil {
+		return err
+	}
+	_, err = s.checkOutranked(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	granted, err := s.queries.GrantUserRole(ctx, database.GrantUserRoleParams{
+		UserID: userID,
+		Role:   role,
+	})
+	if err != nil {
+		return err
+	}
+
+	if granted > 0 {
+		s.audit(ctx, EventRoleGranted, userID, AuditMetadata{"role": role})
+	}
+	return nil
+}
+
+// Take a role away and end the user's sessions, so no token keeps carrying it.
+// Operators may only revoke roles of users they outrank, and the last admin
+// cannot be removed.
+func (s *Service) RevokeRole(ctx context.Context, userID uuid.UUID, role string) error {
+	err := s.validateRole(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.checkOutranked(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if role == auth.RoleAdmin {
+		admins, err := s.queries.CountUsersWithRole(ctx, auth.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return fmt.Errorf("%w: cannot revoke the last admin", ErrConflict)
+		}
+	}
+
+	revoked, err := s.queries.RevokeUserRole(ctx, database.RevokeUserRoleParams{
+		UserID: userID,
+		Role:   role,
+	})
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+
+	err = s.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventRoleRevoked, userID, AuditMetadata{"role": role, "sessions_revoked": true})
+	return nil
+}
+
+// Operators may only grant roles ranking below their own, so no one can
+// raise another user to their level. Without an operator in ctx, as from
+// the admin CLI, any role may be granted.
+func (s *Service) checkGrantable(ctx context.Context, role string) error {
+	actorID, ok := ctx.Value(actorContextKey).(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	actorRoles, err := s.userRoles(ctx, actorID)
+	if err != nil {
+		return err
+	}
+	if !auth.Outranks(actorRoles, []string{role}) {
+		return fmt.Errorf("%w: cannot grant a role equal to or above your own", ErrForbidden)
+	}
+	return nil
+}
+
+// Roles live in the database, the user role is implied and never stored
+func (s *Service) validateRole(ctx context.Context, role string) error {
+	if role == auth.RoleUser {
+		return fmt.Errorf("%w: every user has the %s role", ErrInvalid, auth.RoleUser)
+	}
+
+	exists, err := s.queries.RoleExists(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalid, role)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/mailer"
+	"main/internal/oidc"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Errors returned by the service, transports map them to status codes
+var (
+	ErrNotFound     = errors.New("Not found")
+	ErrUnauthorized = errors.New("Unauthorized")
+	ErrForbidden    = errors.New("Forbidden")
+	ErrInvalid      = errors.New("Invalid input")
+	ErrConflict     = errors.New("Conflict")
+	ErrRateLimited  = errors.New("Too many requests")
+)
+
+// Returned when a caller must wait before retrying, matches ErrRateLimited
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// Maps a unique constraint violation to ErrConflict, other errors pass through
+func uniqueConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrConflict, pqErr.Message)
+	}
+	return err
+}
+
+type Config struct {
+	TokenSecret string
+	// Public URL used in links sent by email
+	BaseURL string
+	Mailer  mailer.Mailer
+	// Refuse chirps from users who have not verified their email
+	RequireVerifiedEmail bool
+	// External OpenID Connect providers users may sign in with
+	OIDCProviders []*oidc.Provider
+	// RS256, ES256 or EdDSA to sign access tokens with rotated keys,
+	// empty signs them with TokenSecret
+	JWTAlgorithm        string
+	KeyRotationInterval time.Duration
+	// Issuer, audience and leeway of access tokens, zero fields take the defaults
+	TokenOptions         auth.TokenOptions
+	AccessTokenLifetime  time.Duration
+	RefreshTokenLifetime time.Duration
+	// Hashing of new passwords and the rules they must meet, zero values take the defaults
+	PasswordHashing auth.PasswordHashing
+	PasswordPolicy  auth.PasswordPolicy
+	// How long audit events are kept, zero keeps them forever and anything
+	// else at least MinAuditRetention
+	AuditRetention time.Duration
+	// How long webhook deliveries are kept, zero keeps them forever.
+	// Rejected ones are dropped after RejectedDeliveryRetention at most.
+	WebhookRetention time.Duration
+	// Checks signatures of Polka webhooks
+	PolkaWebhooks auth.WebhookVerifier
+}
+
+// Business logic shared by the REST and gRPC APIs
+type Service struct {
+	queries              *database.Queries
+	tokenSecret          string
+	baseURL              string
+	mailer               mailer.Mailer
+	requireVerifiedEmail bool
+	oidcProviders        map[string]*oidc.Provider
+	keys                 *auth.KeySet
+	jwtAlgorithm         string
+	keyRotationInterval  time.Duration
+	accessTokenLifetime  time.Duration
+	refreshTokenLifetime time.Duration
+	passwords            auth.PasswordHashing
+	passwordPolicy       auth.PasswordPolicy
+	auditRetention       time.Duration
+	webhookRetention     time.Duration
+	polkaWebhooks        auth.WebhookVerifier
+	events               *Broker
+}
+
+func New(queries *database.Queries, cfg Config) *Service {
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, provider := range cfg.OIDCProviders {
+		providers[provider.Name()] = provider
+	}
+
+	// HS256 stays trusted only while it is the signing algorithm
+	hmacSecret := cfg.TokenSecret
+	if cfg.JWTAlgorithm != "" {
+		hmacSecret = ""
+	}
+
+	tokenOptions := cfg.TokenOptions
+	if tokenOptions.Issuer == "" {
+		tokenOptions.Issuer = auth.DefaultTokenOptions.Issuer
+	}
+	if tokenOptions.Audience == "" {
+		tokenOptions.Audience = auth.DefaultTokenOptions.Audience
+	}
+	if tokenOptions.Leeway == 0 {
+		tokenOptions.Leeway = auth.DefaultTokenOptions.Leeway
+	}
+
+	accessTokenLifetime := cfg.AccessTokenLifetime
+	if accessTokenLifetime == 0 {
+		accessTokenLifetime = DefaultAccessTokenLifetime
+	}
+	refreshTokenLifetime := cfg.RefreshTokenLifetime
+	if refreshTokenLifetime == 0 {
+		refreshTokenLifetime = DefaultRefreshTokenLifetime
+	}
+
+	passwords := cfg.PasswordHashing
+	if passwords.Current == nil {
+		passwords = auth.DefaultPasswordHashing
+	}
+	auditRetention := cfg.AuditRetention
+	if auditRetention > 0 && auditRetention < MinAuditRetention {
+		auditRetention = MinAuditRetention
+	}
+
+	passwordPolicy := cfg.PasswordPolicy
+	if passwordPolicy.MinLength == 0 {
+		passwordPolicy.MinLength = auth.DefaultPasswordPolicy.MinLength
+	}
+
+	return &Service{
+		queries:              queries,
+		tokenSecret:          cfg.TokenSecret,
+		baseURL:              cfg.BaseURL,
+		mailer:               cfg.Mailer,
+		requireVerifiedEmail: cfg.RequireVerifiedEmail,
+		oidcProviders:        providers,
+		keys:                 auth.NewKeySetWithOptions(hmacSecret, tokenOptions),
+		jwtAlgorithm:         cfg.JWTAlgorithm,
+		keyRotationInterval:  cfg.KeyRotationInterval,
+		accessTokenLifetime:  accessTokenLifetime,
+		refreshTokenLifetime: refreshTokenLifetime,
+		passwords:            passwords,
+		auditRetention:       auditRetention,
+		webhookRetention:     cfg.WebhookRetention,
+		polkaWebhooks:        cfg.PolkaWebhooks,
+		passwordPolicy:       passwordPolicy,
+		events:               NewBroker(),
+	}
+}
+
+// Broker of chirp events for streaming and federation
+func (s *Service) Events() *Broker {
+	return s.events
+}
+
+type EventType string
+
+const (
+	ChirpCreated EventType = "created"
+	ChirpDeleted EventType = "deleted"
+)
+
+type ChirpEvent struct {
+	Type  EventType
+	Chirp database.Chirp
+}
+
+const subscriberBuffer = 64
+
+// Fan out chirp events to subscribers, slow subscribers miss events rather than block writers
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan ChirpEvent]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan ChirpEvent]struct{}{}}
+}
+
+// Subscribe returns a channel of events and a function to stop receiving them
+func (b *Broker) Subscribe() (<-chan ChirpEvent, func()) {
+	ch := make(chan ChirpEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *Broker) Publish(event ChirpEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/auth"
+	"main/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestBrokerFanOut(t *testing.T) {
+	b := NewBroker()
+	first, stopFirst := b.Subscribe()
+	second, stopSecond := b.Subscribe()
+	defer stopSecond()
+
+	b.Publish(ChirpEvent{Type: ChirpCreated, Chirp: database.Chirp{Body: "hello"}})
+
+	for _, ch := range []<-chan ChirpEvent{first, second} {
+		event := <-ch
+		if event.Type != ChirpCreated || event.Chirp.Body != "hello" {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+
+	stopFirst()
+	stopFirst()
+	if _, ok := <-first; ok {
+		t.Fatal("expected channel to be closed after unsubscribe")
+	}
+
+	b.Publish(ChirpEvent{Type: ChirpDeleted})
+	if event := <-second; event.Type != ChirpDeleted {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func TestBrokerDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroker()
+	ch, stop := b.Subscribe()
+	defer stop()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		b.Publish(ChirpEvent{Type: ChirpCreated})
+	}
+	if len(ch) != subscriberBuffer {
+		t.Fatalf("expected %d buffered events, got %d", subscriberBuffer, len(ch))
+	}
+}
+
+func TestParseHandle(t *testing.T) {
+	handle, err := ParseHandle("@Alice_1")
+	if err != nil || handle.String != "alice_1" {
+		t.Fatalf("got %v, %v", handle, err)
+	}
+	if handle, err := ParseHandle(""); err != nil || handle.Valid {
+		t.Fatalf("expected no handle, got %v, %v", handle, err)
+	}
+	if _, err := ParseHandle("a b"); err == nil {
+		t.Fatal("expected invalid handle error")
+	}
+}
+
+func TestSignedToken(t *testing.T) {
+	s := New(nil, Config{TokenSecret: "secret"})
+	id := uuid.New()
+
+	token := s.signedToken(purposeEmailVerification, id)
+	parsed, err := s.parseSignedToken(purposeEmailVerification, token)
+	if err != nil || parsed != id {
+		t.Fatalf("got %v, %v", parsed, err)
+	}
+
+	if _, err := s.parseSignedToken(purposePasswordReset, token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected token for another purpose to be rejected, got %v", err)
+	}
+
+	other := New(nil, Config{TokenSecret: "other"})
+	if _, err := other.parseSignedToken(purposeEmailVerification, token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected token signed with another secret to be rejected, got %v", err)
+	}
+
+	forged := uuid.New().String() + token[len(id.String()):]
+	if _, err := s.parseSignedToken(purposeEmailVerification, forged); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected forged token to be rejected, got %v", err)
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	var err error = &RateLimitError{RetryAfter: 30 * time.Second}
+	if !errors.Is(err, ErrRateLimited) {
+		t.Error("expected RateLimitError to match ErrRateLimited")
+	}
+}
+
+func TestUniqueConflict(t *testing.T) {
+	if err := uniqueConflict(&pq.Error{Code: "23505", Message: "duplicate key"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected unique violation to be a conflict, got %v", err)
+	}
+	if err := uniqueConflict(&pq.Error{Code: "23503"}); errors.Is(err, ErrConflict) {
+		t.Error("expected other database errors to pass through")
+	}
+	if err := uniqueConflict(sql.ErrConnDone); err != sql.ErrConnDone {
+		t.Errorf("expected error to pass through, got %v", err)
+	}
+}
+
+func TestRejectedHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", "Bearer secret")
+	header.Set("X-Padding", "junk")
+	header.Set(PolkaSignatureHeader, strings.Repeat("a", 1000))
+
+	stored := rejectedHeaders(header)
+	if len(stored) != 2 || stored.Get("Content-Type") != "application/json" {
+		t.Errorf("expected only known headers to be kept, got %v", stored)
+	}
+	if len(stored.Get(PolkaSignatureHeader)) != 512 {
+		t.Errorf("expected long header values to be cut, got %d bytes", len(stored.Get(PolkaSignatureHeader)))
+	}
+}
+
+func TestOAuthError(t *testing.T) {
+	if err := oauthError(OAuthInvalidClient, "bad secret"); !errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrInvalid) {
+		t.Errorf("expected invalid_client to match ErrUnauthorized, got %v", err)
+	}
+	if err := oauthError(OAuthInvalidGrant, "used code"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected invalid_grant to match ErrInvalid, got %v", err)
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	for _, uri := range []string{"https://app.example.com/callback", "http://localhost:3000/cb", "http://127.0.0.1/cb"} {
+		if err := validateRedirectURI(uri); err != nil {
+			t.Errorf("expected %s to be accepted, got %v", uri, err)
+		}
+	}
+	for _, uri := range []string{"", "/callback", "http://app.example.com/cb", "https://app.example.com/cb#frag", "javascript:alert(1)"} {
+		if err := validateRedirectURI(uri); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %q to be rejected, got %v", uri, err)
+		}
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if !verifyCodeChallenge(verifier, challenge) {
+		t.Error("expected RFC 7636 example to verify")
+	}
+	if verifyCodeChallenge("wrong", challenge) {
+		t.Error("expected wrong verifier to be rejected")
+	}
+}
+
+func TestAuthorizationRedirect(t *testing.T) {
+	details := AuthorizationDetails{RedirectURI: "https://app.example.com/cb?tenant=1", State: "xyz"}
+	got := details.Redirect(url.Values{"code": {"abc"}})
+	if got != "https://app.example.com/cb?tenant=1&code=abc&state=xyz" {
+		t.Errorf("unexpected redirect %s", got)
+	}
+}
+
+func TestTokenConfig(t *testing.T) {
+	s := New(nil, Config{TokenSecret: "secret"})
+	if s.accessTokenLifetime != DefaultAccessTokenLifetime || s.refreshTokenLifetime != DefaultRefreshTokenLifetime {
+		t.Errorf("expected default lifetimes, got %s and %s", s.accessTokenLifetime, s.refreshTokenLifetime)
+	}
+
+	token, err := s.sessionJWT(database.Session{ID: uuid.New(), UserID: uuid.New()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := New(nil, Config{TokenSecret: "secret", TokenOptions: auth.TokenOptions{Audience: "another-service"}})
+	if _, err := other.keys.ParseJWT(token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("expected token for another audience to be rejected, got %v", err)
+	}
+	if _, err := s.keys.ParseJWT(token); err != nil {
+		t.Errorf("expected token to validate, got %v", err)
+	}
+}
+
+func TestThrottleLockout(t *testing.T) {
+	policy := throttlePolicy{threshold: 5, baseLockout: time.Minute, maxLockout: time.Hour}
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{1, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{11, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.lockout(tt.failures); got != tt.want {
+			t.Errorf("lockout after %d failures: expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func TestLoginThrottleKeys(t *testing.T) {
+	keys := loginThrottleKeys(" Alice@Example.com", "203.0.113.7")
+	if len(keys) != 2 || keys[0] != "account:alice@example.com" || keys[1] != "ip:203.0.113.7" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if keys := loginThrottleKeys("alice@example.com", ""); len(keys) != 1 {
+		t.Errorf("expected no IP key without an address, got %v", keys)
+	}
+}
+
+func TestSuspension(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	suspended := database.User{
+		SuspendedAt:      sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+		SuspensionReason: sql.NullString{String: "spam", Valid: true},
+	}
+
+	if err := suspension(database.User{}, now); err != nil {
+		t.Errorf("expected no suspension, got %v", err)
+	}
+
+	err := suspension(suspended, now)
+	var suspendedErr *SuspendedError
+	if !errors.As(err, &suspendedErr) || !errors.Is(err, ErrForbidden) || suspendedErr.Reason != "spam" || !suspendedErr.Until.IsZero() {
+		t.Errorf("expected indefinite suspension, got %v", err)
+	}
+
+	suspended.SuspendedUntil = sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+	if err := suspension(suspended, now); !errors.As(err, &suspendedErr) || !suspendedErr.Until.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected suspension until an hour from now, got %v", err)
+	}
+	if err := suspension(suspended, now.Add(time.Hour)); err != nil {
+		t.Errorf("expected suspension to have run out, got %v", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	user := database.User{ID: uuid.New(), CreatedAt: time.Date(2026, 3, 4, 5, 6, 7, 890, time.UTC)}
+	createdAt, id, err := decodeCursor(encodeCursor(user.CreatedAt, user.ID))
+	if err != nil || !createdAt.Equal(user.CreatedAt) || id != user.ID {
+		t.Errorf("expected cursor to round trip, got %s, %s, %v", createdAt, id, err)
+	}
+
+	for _, cursor := range []string{"!!", "bm8tc2VwYXJhdG9y", "eHx5"} {
+		if _, _, err := decodeCursor(cursor); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected cursor %q to be rejected, got %v", cursor, err)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("unexpected escaped search %s", got)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for limit, want := range map[int]int{-1: defaultPageSize, 0: defaultPageSize, 10: 10, 1000: maxPageSize} {
+		if got := pageSize(limit); got != want {
+			t.Errorf("page size for limit %d: expected %d, got %d", limit, want, got)
+		}
+	}
+}
+
+func TestSubscriptionAfter(t *testing.T) {
+	userID := uuid.New()
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := now.Add(30 * 24 * time.Hour)
+
+	upgraded, ok := subscriptionAfter(database.Subscription{}, false, PolkaEvent{
+		Type: PolkaUserUpgraded, UserID: userID, CreatedAt: now, SubscriptionID: "sub_1", CurrentPeriodEnd: periodEnd,
+	})
+	if !ok || upgraded.Status != SubscriptionActive || upgraded.Plan != defaultPlan || upgraded.ProviderRef != "sub_1" || !upgraded.CurrentPeriodEnd.Time.Equal(periodEnd) {
+		t.Fatalf("unexpected subscription after upgrade %+v", upgraded)
+	}
+
+	current := database.Subscription{
+		UserID:           userID,
+		ProviderRef:      upgraded.ProviderRef,
+		Plan:             "red_yearly",
+		Status:           upgraded.Status,
+		CurrentPeriodEnd: upgraded.CurrentPeriodEnd,
+	}
+	tests := []struct {
+		event string
+		want  string
+	}{
+		{PolkaUserRenewed, SubscriptionActive},
+		{PolkaPaymentFailed, SubscriptionPastDue},
+		{PolkaUserCancelled, SubscriptionCancelled},
+		{PolkaUserDowngraded, SubscriptionExpired},
+	}
+	for _, tt := range tests {
+		next, ok := subscriptionAfter(current, true, PolkaEvent{Type: tt.event, UserID: userID, CreatedAt: now.Add(time.Hour)})
+		if !ok || next.Status != tt.want || next.Plan != "red_yearly" || next.ProviderRef != "sub_1" {
+			t.Errorf("%s: unexpected subscription %+v", tt.event, next)
+		}
+	}
+
+	// A cancellation keeps the paid period, a downgrade ends it
+	if next, _ := subscriptionAfter(current, true, PolkaEvent{Type: PolkaUserCancelled, UserID: userID, CreatedAt: now}); !next.CurrentPeriodEnd.Time.Equal(periodEnd) {
+		t.Errorf("expected cancellation to keep the period end, got %v", next.CurrentPeriodEnd)
+	}
+	if next, _ := subscriptionAfter(current, true, PolkaEvent{Type: PolkaUserDowngraded, UserID: userID, CreatedAt: now}); !next.CurrentPeriodEnd.Time.Equal(now) {
+		t.Errorf("expected downgrade to end the period now, got %v", next.CurrentPeriodEnd)
+	}
+
+	if _, ok := subscriptionAfter(database.Subscription{}, false, PolkaEvent{Type: PolkaUserCancelled, UserID: userID, CreatedAt: now}); ok {
+		t.Error("expected cancellation without a subscription to be ignored")
+	}
+	if _, ok := subscriptionAfter(current, true, PolkaEvent{Type: "user.unknown", UserID: userID, CreatedAt: now}); ok {
+		t.Error("expected unknown event to be ignored")
+	}
+}
+
+func TestParsePolkaEvent(t *testing.T) {
+	userID := uuid.New()
+	event, err := parsePolkaEvent([]byte(`{"id":"evt_1","event":"user.upgraded","created_at":"2026-05-01T00:00:00Z","data":{"user_id":"` + userID.String() + `","plan":"red_monthly"}}`))
+	if err != nil || event.ID != "evt_1" || event.Type != PolkaUserUpgraded || event.UserID != userID || event.Plan != "red_monthly" || event.CreatedAt.IsZero() {
+		t.Fatalf("unexpected event %+v, %v", event, err)
+	}
+
+	for _, body := range []string{`not json`, `{"event":"user.upgraded"}`, `{"id":"evt_2","data":{"user_id":"nope"}}`} {
+		if _, err := parsePolkaEvent([]byte(body)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %s to be rejected, got %v", body, err)
+		}
+	}
+}
+
+func TestStoredHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set(PolkaSignatureHeader, "t=1,v1=00")
+	header.Set("Authorization", "ApiKey secret")
+	header.Set("Cookie", "session=secret")
+
+	stored := storedHeaders(header)
+	if stored.Get(PolkaSignatureHeader) == "" || stored.Get("Authorization") != "" || stored.Get("Cookie") != "" {
+		t.Errorf("unexpected stored headers %v", stored)
+	}
+	if header.Get("Authorization") == "" {
+		t.Error("expected request headers to be left alone")
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Details of the client starting a session
+type ClientInfo struct {
+	UserAgent  string
+	IP         string
+	DeviceName string
+}
+
+func (s *Service) createSession(ctx context.Context, userID uuid.UUID, client ClientInfo) (database.Session, error) {
+	return s.queries.CreateSession(ctx, database.CreateSessionParams{
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		Ip:         client.IP,
+		DeviceName: sql.NullString{String: client.DeviceName, Valid: client.DeviceName != ""},
+	})
+}
+
+// Validate an access token, rejecting tokens from revoked sessions
+func (s *Service) AuthenticateSession(ctx context.Context, token string) (auth.Claims, error) {
+	claims, err := s.keys.ParseJWT(token)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	if claims.SessionID != uuid.Nil {
+		_, err = s.queries.TouchSession(ctx, claims.SessionID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.Claims{}, fmt.Errorf("%w: session revoked", ErrUnauthorized)
+		}
+		if err != nil {
+			return auth.Claims{}, err
+		}
+	}
+
+	return claims, nil
+}
+
+// Validate an access token or personal access token and check it carries the scope
+func (s *Service) Authorize(ctx context.Context, token, scope string) (auth.Claims, error) {
+	var claims auth.Claims
+	var err error
+	if auth.IsPersonalAccessToken(token) {
+		claims, err = s.authenticatePersonalToken(ctx, token)
+	} else {
+		claims, err = s.AuthenticateSession(ctx, token)
+	}
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	if !claims.HasScope(scope) {
+		return auth.Claims{}, fmt.Errorf("%w: token lacks scope %s", ErrForbidden, scope)
+	}
+
+	err = s.checkSuspended(ctx, claims.UserID)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// Access token for a session carrying the user's roles, or limited to the
+// granted scopes for an app
+func (s *Service) sessionJWT(session database.Session, roles []string) (string, error) {
+	if session.AppID.Valid {
+		return s.keys.MakeAppJWT(session.UserID, session.ID, session.AppID.UUID, strings.Fields(session.Scopes), s.accessTokenLifetime)
+	}
+	return s.keys.MakeSessionJWT(session.UserID, session.ID, s.accessTokenLifetime, roles...)
+}
+
+func (s *Service) ListSessions(ctx context.Context, userID uuid.UUID) ([]database.Session, error) {
+	return s.queries.GetUserSessions(ctx, userID)
+}
+
+// Revoke one of the user's sessions and its refresh tokens
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	revoked, err := s.queries.RevokeUserSession(ctx, database.RevokeUserSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+
+	err = s.queries.RevokeTokenFamily(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventTokenRevoked, userID, AuditMetadata{"session_id": sessionID})
+	return nil
+}
+
+// Log out everywhere. Personal access tokens go too, otherwise a token
+// minted from a hijacked session would outlive a password reset.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	err := s.queries.RevokeUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.queries.RevokeUserTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.queries.RevokeUserPersonalAccessTokens(ctx, userID)
+}
+
+func (s *Service) revokeSessionByID(ctx context.Context, sessionID uuid.UUID) error {
+	err := s.queries.RevokeSessionByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return s.queries.RevokeTokenFamily(ctx, sessionID)
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"time"
+)
+
+// New keys are published this long before they sign, so verifiers that cache
+// the JWKS have them before the first token arrives
+const keyPublishLead = time.Hour
+
+// Public keys that verify access tokens
+func (s *Service) JWKS() auth.JWKSet {
+	return s.keys.JWKS()
+}
+
+// Load the signing keys, first creating a new key when the newest is older
+// than the rotation interval or uses another algorithm. Keys it replaces
+// retire once the tokens they signed have expired.
+func (s *Service) RotateSigningKeys(ctx context.Context) error {
+	if s.jwtAlgorithm == "" {
+		return nil
+	}
+
+	stored, err := s.queries.GetUnretiredJwtKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if len(stored) == 0 || s.rotationDue(stored[len(stored)-1], now) {
+		// The very first key has nothing to take over from, so it signs at once
+		activatesAt := now.Add(keyPublishLead)
+		if len(stored) == 0 {
+			activatesAt = now
+		}
+
+		err = s.createSigningKey(ctx, activatesAt)
+		if err != nil {
+			return err
+		}
+
+		stored, err = s.queries.GetUnretiredJwtKeys(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(stored))
+	for _, row := range stored {
+		key, err := auth.ParseSigningKey(row.ID, row.Algorithm, row.PrivateKeyPem)
+		if err != nil {
+			log.Printf("Error parsing signing key %s: %s", row.ID, err)
+			continue
+		}
+		key.ActivatesAt = row.ActivatesAt
+		key.RetiresAt = row.RetiresAt.Time
+		keys = append(keys, key)
+	}
+
+	s.keys.SetKeys(keys)
+	return nil
+}
+
+func (s *Service) rotationDue(newest database.JwtKey, now time.Time) bool {
+	if newest.Algorithm != s.jwtAlgorithm {
+		return true
+	}
+	return s.keyRotationInterval > 0 && now.After(newest.ActivatesAt.Add(s.keyRotationInterval))
+}
+
+func (s *Service) createSigningKey(ctx context.Context, activatesAt time.Time) error {
+	key, err := auth.GenerateSigningKey(s.jwtAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	privateKeyPEM, err := key.MarshalPrivateKey()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.queries.CreateJwtKey(ctx, database.CreateJwtKeyParams{
+		ID:            key.ID,
+		Algorithm:     key.Algorithm,
+		PrivateKeyPem: privateKeyPEM,
+		ActivatesAt:   activatesAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.queries.RetireJwtKeys(ctx, database.RetireJwtKeysParams{
+		ActivatesAt: activatesAt,
+		RetiresAt:   sql.NullTime{Time: activatesAt.Add(s.accessTokenLifetime), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Created %s signing key %s, active from %s", key.Algorithm, key.ID, activatesAt.Format(time.RFC3339))
+	return s.queries.DeleteRetiredJwtKeys(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+}
+
+// Rotate keys on schedule and pick up keys created by other instances
+func (s *Service) RunKeyRotation(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.RotateSigningKeys(ctx)
+			if err != nil {
+				log.Printf("Error rotating signing keys: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription statuses. Every status but expired carries Chirpy Red:
+// past_due while Polka retries the payment, cancelled until the paid
+// period runs out.
+const (
+	SubscriptionActive    = "active"
+	SubscriptionPastDue   = "past_due"
+	SubscriptionCancelled = "cancelled"
+	SubscriptionExpired   = "expired"
+)
+
+const (
+	providerManual = "manual"
+
+	defaultPlan = "red"
+	// Period assumed when an event does not say when it ends
+	defaultSubscriptionPeriod = 30 * 24 * time.Hour
+	// Time past the period end for a late renewal before Red is taken away
+	subscriptionGracePeriod = 3 * 24 * time.Hour
+)
+
+// Grant or take away Chirpy Red by hand, overriding the subscription until
+// the provider sends a newer event
+func (s *Service) SetChirpyRed(ctx context.Context, userID uuid.UUID, enabled bool) (database.User, error) {
+	now := time.Now().UTC()
+	params := database.UpsertSubscriptionParams{
+		UserID:      userID,
+		Provider:    providerManual,
+		Plan:        defaultPlan,
+		Status:      SubscriptionActive,
+		LastEventAt: now,
+	}
+	if !enabled {
+		params.Status = SubscriptionExpired
+		params.CurrentPeriodEnd = sql.NullTime{Time: now, Valid: true}
+	}
+
+	user, changed, err := s.updateSubscription(ctx, params)
+	if err != nil {
+		return user, err
+	}
+
+	if changed {
+		s.audit(ctx, chirpyRedEvent(enabled), userID, AuditMetadata{"source": "admin"})
+	}
+	return user, nil
+}
+
+// Apply a Polka subscription event. Events older than the last one
+// applied to the subscription are ignored, Polka does not guarantee order.
+func (s *Service) applySubscriptionEvent(ctx context.Context, event PolkaEvent) error {
+	if event.UserID == uuid.Nil {
+		return fmt.Errorf("%w: event has no user", ErrInvalid)
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	current, err := s.queries.GetUserSubscription(ctx, event.UserID)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	params, ok := subscriptionAfter(current, exists, event)
+	if !ok {
+		log.Printf("Ignoring Polka event %s of type %s for user %s", event.ID, event.Type, event.UserID)
+		return nil
+	}
+
+	user, changed, err := s.updateSubscription(ctx, params)
+	if errors.Is(err, errStaleEvent) {
+		log.Printf("Ignoring Polka event %s, a newer event was already applied", event.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		s.recordAuditEvent(ctx, chirpyRedEvent(user.IsChirpyRed.Bool), uuid.Nil, user.ID, AuditMetadata{
+			"source": providerPolka,
+			"event":  event.Type,
+			"plan":   params.Plan,
+		})
+	}
+	return nil
+}
+
+// The subscription after a Polka event, false when the event is unknown or
+// needs a subscription the user does not have
+func subscriptionAfter(current database.Subscription, exists bool, event PolkaEvent) (database.UpsertSubscriptionParams, bool) {
+	params := database.UpsertSubscriptionParams{
+		UserID:           event.UserID,
+		Provider:         providerPolka,
+		ProviderRef:      current.ProviderRef,
+		Plan:             current.Plan,
+		Status:           current.Status,
+		CurrentPeriodEnd: current.CurrentPeriodEnd,
+		LastEventAt:      event.CreatedAt.UTC(),
+	}
+	if event.SubscriptionID != "" {
+		params.ProviderRef = event.SubscriptionID
+	}
+	if event.Plan != "" {
+		params.Plan = event.Plan
+	}
+	if params.Plan == "" {
+		params.Plan = defaultPlan
+	}
+	if !event.CurrentPeriodEnd.IsZero() {
+		params.CurrentPeriodEnd = sql.NullTime{Time: event.CurrentPeriodEnd.UTC(), Valid: true}
+	}
+
+	switch event.Type {
+	case PolkaUserUpgraded, PolkaUserRenewed:
+		params.Status = SubscriptionActive
+		if event.CurrentPeriodEnd.IsZero() {
+			params.CurrentPeriodEnd = sql.NullTime{Time: event.CreatedAt.UTC().Add(defaultSubscriptionPeriod), Valid: true}
+		}
+	case PolkaPaymentFailed:
+		params.Status = SubscriptionPastDue
+	case PolkaUserCancelled:
+		params.Status = SubscriptionCancelled
+		// Without a paid period there is nothing left to run out
+		if !params.CurrentPeriodEnd.Valid {
+			params.CurrentPeriodEnd = sql.NullTime{Time: event.CreatedAt.UTC(), Valid: true}
+		}
+	case PolkaUserDowngraded:
+		params.Status = SubscriptionExpired
+		params.CurrentPeriodEnd = sql.NullTime{Time: event.CreatedAt.UTC(), Valid: true}
+	default:
+		return params, false
+	}
+
+	if !exists && params.Status != SubscriptionActive {
+		return params, false
+	}
+	return params, true
+}
+
+var errStaleEvent = errors.New("subscription changed by a newer event")
+
+// Store the subscription and derive Chirpy Red from it, reporting whether
+// the user gained or lost Red. Both change in one statement so the flag
+// cannot drift from the subscription.
+func (s *Service) updateSubscription(ctx context.Context, params database.UpsertSubscriptionParams) (database.User, bool, error) {
+	previous, err := s.getUser(ctx, params.UserID)
+	if err != nil {
+		return previous, false, err
+	}
+
+	user, err := s.queries.UpsertSubscription(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return previous, false, errStaleEvent
+	}
+	if err != nil {
+		return previous, false, err
+	}
+	return user, user.IsChirpyRed.Bool != previous.IsChirpyRed.Bool, nil
+}
+
+// Expire subscriptions past their period, active ones after a grace
+// period for late renewals. Their users lose Red in the same statement.
+func (s *Service) expireSubscriptions(ctx context.Context) error {
+	now := time.Now().UTC()
+	expired, err := s.queries.ExpireLapsedSubscriptions(ctx, database.ExpireLapsedSubscriptionsParams{
+		Now:         now,
+		GraceCutoff: now.Add(-subscriptionGracePeriod),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range expired {
+		s.recordAuditEvent(ctx, EventChirpyRedRevoked, uuid.Nil, subscription.UserID, AuditMetadata{
+			"source": "expiry",
+			"plan":   subscription.Plan,
+		})
+	}
+	return nil
+}
+
+func chirpyRedEvent(enabled bool) string {
+	if enabled {
+		return EventChirpyRedGranted
+	}
+	return EventChirpyRedRevoked
+}
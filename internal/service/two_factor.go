@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"main/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	loginChallengeLifetime = 5 * time.Minute
+	loginChallengeAttempts = 5
+	recoveryCodeCount      = 10
+	totpQRCodeSize         = 256
+)
+
+type TOTPEnrolment struct {
+	Secret string
+	URI    string
+}
+
+func (s *Service) getUser(ctx context.Context, userID uuid.UUID) (database.User, error) {
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+// Generate a new TOTP secret, it is not enforced until ConfirmTOTP
+func (s *Service) BeginTOTPEnrolment(ctx context.Context, userID uuid.UUID) (TOTPEnrolment, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return TOTPEnrolment{}, err
+	}
+
+	user, err := s.queries.SetUserTotpSecret(ctx, database.SetUserTotpSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID:         userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return TOTPEnrolment{}, fmt.Errorf("%w: two-factor authentication is already enabled", ErrConflict)
+	}
+	if err != nil {
+		return TOTPEnrolment{}, err
+	}
+
+	return TOTPEnrolment{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, user.Email),
+	}, nil
+}
+
+// QR code PNG of the pending TOTP secret
+func (s *Service) TOTPQRCode(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TotpSecret.Valid || user.TotpEnabledAt.Valid {
+		return nil, fmt.Errorf("%w: no two-factor enrolment in progress", ErrNotFound)
+	}
+
+	return auth.TOTPQRCode(auth.TOTPURI(user.TotpSecret.String, user.Email), totpQRCodeSize)
+}
+
+// Enable two-factor authentication once the user proves their authenticator
+// works, returning recovery codes that are only shown this once
+func (s *Service) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TotpSecret.Valid || user.TotpEnabledAt.Valid {
+		return nil, fmt.Errorf("%w: no two-factor enrolment in progress", ErrInvalid)
+	}
+
+	err = s.verifyTOTP(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.queries.EnableUserTotp(ctx, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: two-factor authentication is already enabled", ErrConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, EventTwoFactorEnabled, user.ID, AuditMetadata{"method": "totp"})
+	return codes, nil
+}
+
+// Turn off two-factor authentication, requires a current code or recovery code
+func (s *Service) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		return fmt.Errorf("%w: two-factor authentication is not enabled", ErrInvalid)
+	}
+
+	err = s.verifySecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+
+	err = s.queries.DisableUserTotp(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.queries.DeleteUserRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventTwoFactorDisabled, user.ID, AuditMetadata{"method": "totp"})
+	return nil
+}
+
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.queries.DeleteUserRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		err = s.queries.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// Accept a TOTP code at most once
+func (s *Service) verifyTOTP(ctx context.Context, user database.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return fmt.Errorf("%w: invalid code", ErrUnauthorized)
+	}
+
+	updated, err := s.queries.UseUserTotpStep(ctx, database.UseUserTotpStepParams{
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+		ID:           user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: code already used", ErrUnauthorized)
+	}
+
+	return nil
+}
+
+// Accept either a TOTP code or an unused recovery code
+func (s *Service) verifySecondFactor(ctx context.Context, user database.User, code string) error {
+	err := s.verifyTOTP(ctx, user, code)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+
+	used, err := s.queries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashRecoveryCode(code),
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return fmt.Errorf("%w: invalid code", ErrUnauthorized)
+	}
+
+	s.audit(ctx, EventRecoveryCodeUsed, user.ID, nil)
+	return nil
+}
+
+func (s *Service) createLoginChallenge(ctx context.Context, user database.User) (LoginResult, error) {
+	challenge, err := s.queries.CreateLoginChallenge(ctx, database.CreateLoginChallengeParams{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(loginChallengeLifetime),
+	})
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return LoginResult{
+		User:           user,
+		ChallengeToken: s.signedToken(purposeLoginChallenge, challenge.ID),
+	}, nil
+}
+
+// Exchange a login challenge and a second factor for a session
+func (s *Service) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code string, client ClientInfo) (LoginResult, error) {
+	id, err := s.parseSignedToken(purposeLoginChallenge, challengeToken)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+
+	challenge, err := s.queries.AttemptLoginChallenge(ctx, database.AttemptLoginChallengeParams{
+		ID:       id,
+		Attempts: loginChallengeAttempts,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginResult{}, fmt.Errorf("%w: challenge expired, used or out of attempts", ErrUnauthorized)
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	user, err := s.getUser(ctx, challenge.UserID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords, so
+	// starting new challenges does not give unlimited guesses
+	err = s.checkLoginThrottle(ctx, user.Email, client.IP)
+	if err != nil {
+		s.recordAuditEvent(ctx, EventLoginFailed, uuid.Nil, user.ID, AuditMetadata{"reason": "locked"})
+		return LoginResult{}, err
+	}
+
+	err = s.verifySecondFactor(ctx, user, code)
+	if errors.Is(err, ErrUnauthorized) {
+		s.recordLoginFailure(ctx, user.Email, client.IP, user)
+		s.recordAuditEvent(ctx, EventLoginFailed, uuid.Nil, user.ID, AuditMetadata{"reason": "wrong_second_factor"})
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	used, err := s.queries.UseLoginChallenge(ctx, challenge.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if used == 0 {
+		return LoginResult{}, fmt.Errorf("%w: challenge already used", ErrUnauthorized)
+	}
+
+	result, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return result, err
+	}
+	s.clearLoginFailures(ctx, user.Email)
+	return result, nil
+}
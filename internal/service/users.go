@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/auth"
+	"main/internal/database"
+	"main/internal/mailer"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Token lifetimes used when the config leaves them unset
+const (
+	DefaultAccessTokenLifetime  = time.Hour
+	DefaultRefreshTokenLifetime = 60 * 24 * time.Hour
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// Normalize an optional handle, empty means no handle
+func ParseHandle(handle string) (sql.NullString, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if handle == "" {
+		return sql.NullString{}, nil
+	}
+	if !handlePattern.MatchString(handle) {
+		return sql.NullString{}, fmt.Errorf("%w: handle must be 3-30 letters, digits or underscores", ErrInvalid)
+	}
+
+	return sql.NullString{String: handle, Valid: true}, nil
+}
+
+type UserParams struct {
+	Email    string
+	Password string
+	Handle   string
+}
+
+type LoginResult struct {
+	User         database.User
+	Token        string
+	RefreshToken string
+	// Set instead of the tokens when the user must complete a second factor
+	ChallengeToken string
+}
+
+type RefreshResult struct {
+	Token        string
+	RefreshToken string
+}
+
+// Validate an access token carrying the scope and return its user
+func (s *Service) Authenticate(ctx context.Context, token, scope string) (uuid.UUID, error) {
+	claims, err := s.Authorize(ctx, token, scope)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+func validateEmail(email string) error {
+	err := mailer.ValidateAddress(email)
+	if err != nil {
+		return fmt.Errorf("%w: invalid email address: %s", ErrInvalid, err)
+	}
+	return nil
+}
+
+// Hash a new password once it meets the password policy
+func (s *Service) hashNewPassword(password string) (string, error) {
+	err := s.passwordPolicy.Validate(password)
+	if errors.Is(err, auth.ErrPasswordTooShort) || errors.Is(err, auth.ErrPasswordBreached) {
+		return "", fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return s.passwords.Hash(password)
+}
+
+func (s *Service) CreateUser(ctx context.Context, params UserParams) (database.User, error) {
+	err := validateEmail(params.Email)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	handle, err := ParseHandle(params.Handle)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	log.Print("Creating hashed password")
+	hashed, err := s.hashNewPassword(params.Password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	log.Printf("Creating user with email, %s", params.Email)
+	user, err := s.queries.CreateUser(ctx, database.CreateUserParams{
+		Email:          params.Email,
+		HashedPassword: hashed,
+		Handle:         handle,
+	})
+	if err != nil {
+		return user, uniqueConflict(err)
+	}
+
+	s.trySendVerification(ctx, user)
+	return user, nil
+}
+
+func (s *Service) UpdateUser(ctx context.Context, userID uuid.UUID, params UserParams) (database.User, error) {
+	err := validateEmail(params.Email)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	handle, err := ParseHandle(params.Handle)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	previous, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	log.Print("Creating hashed password")
+	hashedPassword, err := s.hashNewPassword(params.Password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	// An empty handle keeps the current one
+	user, err := s.queries.UpdateUser(ctx, database.UpdateUserParams{
+		Email:          params.Email,
+		HashedPassword: hashedPassword,
+		Handle:         handle,
+		ID:             userID,
+	})
+	if err != nil {
+		return user, uniqueConflict(err)
+	}
+
+	// Changing the email address clears its verification
+	if user.Email != previous.Email {
+		s.audit(ctx, EventEmailChanged, userID, AuditMetadata{"previous_email": previous.Email, "email": user.Email})
+		s.trySendVerification(ctx, user)
+	}
+
+	// Every update sends the password, only a different one is a change
+	if _, err := s.passwords.Check(previous.HashedPassword, params.Password); err != nil {
+		s.audit(ctx, EventPasswordChanged, userID, nil)
+	}
+
+	return user, nil
+}
+
+// Check credentials, then either start a session or, with two-factor
+// authentication enabled, return a challenge for CompleteTwoFactorLogin
+func (s *Service) Login(ctx context.Context, email, password string, client ClientInfo) (LoginResult, error) {
+	err := s.checkLoginThrottle(ctx, email, client.IP)
+	if err != nil {
+		s.recordAuditEvent(ctx, EventLoginFailed, uuid.Nil, uuid.Nil, AuditMetadata{"email": email, "reason": "locked"})
+		return LoginResult{}, err
+	}
+
+	log.Printf("Getting user with email, %s", email)
+
+	user, err := s.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Printf("Error getting user in database: %s", err)
+		s.recordLoginFailure(ctx, email, client.IP, database.User{})
+		s.recordAuditEvent(ctx, EventLoginFailed, uuid.Nil, uuid.Nil, AuditMetadata{"email": email, "reason": "unknown_email"})
+		return LoginResult{}, ErrUnauthorized
+	}
+
+	rehash, err := s.passwords.Check(user.HashedPassword, password)
+	if err != nil {
+		log.Printf("Error checking password: %s", err)
+		s.recordLoginFailure(ctx, email, client.IP, user)
+		s.recordAuditEvent(ctx, EventLoginFailed, uuid.Nil, user.ID, AuditMetadata{"reason": "wrong_password"})
+		return LoginResult{}, ErrUnauthorized
+	}
+
+	if rehash {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	// Only reported to callers who know the password
+	err = suspension(user, time.Now().UTC())
+	if err != nil {
+		s.recordAuditEvent(ctx, EventLoginFailed, uuid.Nil, user.ID, AuditMetadata{"reason": "suspended"})
+		return LoginResult{}, err
+	}
+
+	// Failures are only forgotten once the second factor is also accepted
+	if user.TotpEnabledAt.Valid {
+		return s.createLoginChallenge(ctx, user)
+	}
+
+	result, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return result, err
+	}
+	s.clearLoginFailures(ctx, email)
+	return result, nil
+}
+
+// Replace a hash made with an outdated algorithm or parameters, the login
+// goes ahead even if this fails
+func (s *Service) rehashPassword(ctx context.Context, user database.User, password string) {
+	hashed, err := s.passwords.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	_, err = s.queries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		HashedPassword: hashed,
+		ID:             user.ID,
+	})
+	if err != nil {
+		log.Printf("Error storing rehashed password: %s", err)
+		return
+	}
+	log.Printf("Rehashed password of user %s", user.ID)
+}
+
+// Start a session and issue its access token and refresh token
+func (s *Service) startSession(ctx context.Context, user database.User, client ClientInfo) (LoginResult, error) {
+	err := suspension(user, time.Now().UTC())
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	// Every login starts a new session, which is also the refresh token family
+	session, err := s.createSession(ctx, user.ID, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	roles, err := s.userRoles(ctx, user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	token, err := s.sessionJWT(session, roles)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, user.ID, session.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	s.audit(ctx, EventLoginSucceeded, user.ID, AuditMetadata{"session_id": session.ID})
+
+	return LoginResult{
+		User:         user,
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (s *Service) issueRefreshToken(ctx context.Context, userID, familyID uuid.UUID) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.queries.CreateToken(ctx, database.CreateTokenParams{
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(s.refreshTokenLifetime),
+		FamilyID:  familyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// Exchange a refresh token for a new access token and a rotated refresh token.
+// Presenting a token that was already exchanged revokes its whole family,
+// since either the client or an attacker is holding a stolen copy.
+func (s *Service) RefreshAccessToken(ctx context.Context, refreshToken string) (RefreshResult, error) {
+	used, err := s.queries.UseRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshResult{}, s.rejectRefreshToken(ctx, refreshToken)
+	}
+	if err != nil {
+		return RefreshResult{}, err
+	}
+
+	session, err := s.queries.TouchSession(ctx, used.FamilyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshResult{}, fmt.Errorf("%w: session revoked", ErrUnauthorized)
+	}
+	if err != nil {
+		return RefreshResult{}, err
+	}
+
+	err = s.checkSuspended(ctx, session.UserID)
+	if err != nil {
+		return RefreshResult{}, err
+	}
+
+	// Roles are read again so changes apply from the next refresh
+	var roles []string
+	if !session.AppID.Valid {
+		roles, err = s.userRoles(ctx, session.UserID)
+		if err != nil {
+			return RefreshResult{}, err
+		}
+	}
+
+	token, err := s.sessionJWT(session, roles)
+	if err != nil {
+		return RefreshResult{}, err
+	}
+
+	rotated, err := s.issueRefreshToken(ctx, used.UserID, used.FamilyID)
+	if err != nil {
+		return RefreshResult{}, err
+	}
+
+	s.audit(ctx, EventTokenRefreshed, session.UserID, AuditMetadata{"session_id": session.ID})
+
+	return RefreshResult{
+		Token:        token,
+		RefreshToken: rotated,
+	}, nil
+}
+
+// Work out why a refresh token could not be used, revoking its session on reuse
+func (s *Service) rejectRefreshToken(ctx context.Context, refreshToken string) error {
+	stored, err := s.queries.GetRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnauthorized
+	}
+	if err != nil {
+		return err
+	}
+
+	if stored.UsedAt.Valid {
+		err = s.revokeSessionByID(ctx, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+		s.recordAuditEvent(ctx, EventRefreshTokenReuse, uuid.Nil, stored.UserID, AuditMetadata{
+			"session_id": stored.FamilyID,
+			"used_at":    stored.UsedAt.Time,
+		})
+		return fmt.Errorf("%w: refresh token reused", ErrUnauthorized)
+	}
+
+	return fmt.Errorf("%w: refresh token expired or revoked", ErrUnauthorized)
+}
+
+// Revoke the session a refresh token belongs to
+func (s *Service) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	stored, err := s.queries.GetRefreshToken(ctx, auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+
+	err = s.revokeSessionByID(ctx, stored.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, EventTokenRevoked, stored.UserID, AuditMetadata{"session_id": stored.FamilyID})
+	return nil
+}
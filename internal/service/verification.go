@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"main/internal/database"
+	"main/internal/mailer"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	verificationLifetime = 48 * time.Hour
+	// Minimum wait between verification emails, and the daily cap
+	verificationResendInterval = time.Minute
+	verificationsPerDay        = 5
+)
+
+// Email a single-use verification link for the user's current address
+func (s *Service) sendVerification(ctx context.Context, user database.User) error {
+	verification, err := s.queries.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(verificationLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/app/verify.html?token=" + url.QueryEscape(s.signedToken(purposeEmailVerification, verification.ID))
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm that %s is your email address by opening this link within %d hours:\n\n%s\n\nIf you did not sign up for Chirpy you can ignore this email.\n",
+			user.Email, int(verificationLifetime.Hours()), link),
+	})
+}
+
+// Send a verification email without failing the request that triggered it
+func (s *Service) trySendVerification(ctx context.Context, user database.User) {
+	err := s.sendVerification(ctx, user)
+	if err != nil {
+		log.Printf("Error sending verification email to %s: %s", user.Email, err)
+	}
+}
+
+// Send a fresh verification link, throttled per user
+func (s *Service) ResendVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		return fmt.Errorf("%w: email is already verified", ErrInvalid)
+	}
+
+	now := time.Now().UTC()
+	recent, err := s.queries.GetRecentEmailVerifications(ctx, database.GetRecentEmailVerificationsParams{
+		UserID:    user.ID,
+		CreatedAt: now.Add(-24 * time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(recent) > 0 {
+		if wait := recent[0].CreatedAt.Add(verificationResendInterval).Sub(now); wait > 0 {
+			return &RateLimitError{RetryAfter: wait}
+		}
+	}
+	if len(recent) >= verificationsPerDay {
+		oldest := recent[verificationsPerDay-1]
+		return &RateLimitError{RetryAfter: oldest.CreatedAt.Add(24 * time.Hour).Sub(now)}
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+// Redeem a verification token, it only counts for the address it was sent to
+func (s *Service) VerifyEmail(ctx context.Context, token string) (database.User, error) {
+	id, err := s.parseSignedToken(purposeEmailVerification, token)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	verification, err := s.queries.UseEmailVerification(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("%w: verification link expired or already used", ErrInvalid)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := s.queries.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("%w: email address has changed since the link was sent", ErrInvalid)
+	}
+	return user, err
+}
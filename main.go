@@ -1,16 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"main/internal/activitypub"
 	"main/internal/auth"
 	"main/internal/database"
+	"main/internal/feed"
+	"main/internal/graph"
+	"main/internal/grpcapi"
+	"main/internal/mailer"
+	"main/internal/oidc"
+	"main/internal/openapi"
+	"main/internal/service"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	graphql "github.com/graph-gophers/graphql-go"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -20,7 +35,11 @@ type apiConfig struct {
 	queries        *database.Queries
 	platform       string
 	tokenSecret    string
-	polkaKey       string
+	baseURL        string
+	federation     *activitypub.Client
+	deliveries     chan delivery
+	graphql        *graphql.Schema
+	service        *service.Service
 }
 
 func main() {
@@ -30,26 +49,79 @@ func main() {
 
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		fmt.Errorf("Error opening database: %s", err)
+		log.Fatalf("Error opening database: %s", err)
 	}
 	dbQueries := database.New(db)
 
+	graphqlSchema, err := graph.NewSchema(dbQueries)
+	if err != nil {
+		log.Fatalf("Error parsing GraphQL schema: %s", err)
+	}
+
 	const port = "8080"
 	const filepathRoot = "."
 
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+
 	apiCfg := apiConfig{
 		fileServerHits: atomic.Int32{},
 		queries:        dbQueries,
 		platform:       os.Getenv("PLATFORM"),
 		tokenSecret:    os.Getenv("TOKEN_SECRET"),
-		polkaKey:       os.Getenv("POLKA_KEY"),
+		baseURL:        baseURL,
+		federation:     activitypub.NewClient(os.Getenv("PLATFORM") == "dev"),
+		graphql:        graphqlSchema,
+		service: service.New(dbQueries, service.Config{
+			TokenSecret:          os.Getenv("TOKEN_SECRET"),
+			BaseURL:              baseURL,
+			Mailer:               newMailer(),
+			RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+			OIDCProviders:        newOIDCProviders(baseURL),
+			JWTAlgorithm:         os.Getenv("JWT_ALGORITHM"),
+			KeyRotationInterval:  durationEnv("JWT_ROTATION_INTERVAL", 30*24*time.Hour),
+			TokenOptions: auth.TokenOptions{
+				Issuer:   os.Getenv("JWT_ISSUER"),
+				Audience: os.Getenv("JWT_AUDIENCE"),
+				Leeway:   durationEnv("JWT_LEEWAY", auth.DefaultTokenOptions.Leeway),
+			},
+			AccessTokenLifetime:  durationEnv("ACCESS_TOKEN_TTL", service.DefaultAccessTokenLifetime),
+			RefreshTokenLifetime: durationEnv("REFRESH_TOKEN_TTL", service.DefaultRefreshTokenLifetime),
+			PasswordHashing:      newPasswordHashing(),
+			PasswordPolicy:       newPasswordPolicy(),
+			AuditRetention:       durationEnv("AUDIT_RETENTION", 365*24*time.Hour),
+			WebhookRetention:     durationEnv("WEBHOOK_RETENTION", 90*24*time.Hour),
+			PolkaWebhooks:        newPolkaWebhooks(),
+		}),
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerHitCount)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerResetCount)
+	mux.Handle("GET /admin/metrics", apiCfg.middlewarePermission(auth.PermMetricsRead, apiCfg.handlerHitCount))
+	mux.Handle("POST /admin/reset", apiCfg.middlewarePermission(auth.PermDataReset, apiCfg.handlerResetCount))
+	mux.Handle("GET /admin/audit_events", apiCfg.middlewarePermission(auth.PermAuditRead, apiCfg.handlerListAuditEvents))
+	mux.Handle("GET /admin/webhooks", apiCfg.middlewarePermission(auth.PermWebhooksRead, apiCfg.handlerListWebhookDeliveries))
+	mux.Handle("GET /admin/webhooks/{deliveryID}", apiCfg.middlewarePermission(auth.PermWebhooksRead, apiCfg.handlerGetWebhookDelivery))
+	mux.Handle("POST /admin/webhooks/{deliveryID}/replay", apiCfg.middlewarePermission(auth.PermWebhooksReplay, apiCfg.handlerReplayWebhookDelivery))
+	mux.Handle("GET /admin/users", apiCfg.middlewarePermission(auth.PermUsersRead, apiCfg.handlerAdminListUsers))
+	mux.Handle("GET /admin/users/{userID}", apiCfg.middlewarePermission(auth.PermUsersRead, apiCfg.handlerAdminGetUser))
+	mux.Handle("DELETE /admin/users/{userID}", apiCfg.middlewarePermission(auth.PermUsersDelete, apiCfg.handlerAdminDeleteUser))
+	mux.Handle("POST /admin/users/{userID}/suspend", apiCfg.middlewarePermission(auth.PermUsersSuspend, apiCfg.handlerSuspendUser))
+	mux.Handle("POST /admin/users/{userID}/unsuspend", apiCfg.middlewarePermission(auth.PermUsersSuspend, apiCfg.handlerUnsuspendUser))
+	mux.Handle("POST /admin/users/{userID}/logout", apiCfg.middlewarePermission(auth.PermUsersLogout, apiCfg.handlerForceLogout))
+	mux.Handle("PUT /admin/users/{userID}/chirpy_red", apiCfg.middlewarePermission(auth.PermUsersChirpyRed, apiCfg.handlerSetChirpyRed))
+	mux.Handle("DELETE /admin/users/{userID}/chirpy_red", apiCfg.middlewarePermission(auth.PermUsersChirpyRed, apiCfg.handlerSetChirpyRed))
+	mux.Handle("POST /admin/users/{userID}/unlock", apiCfg.middlewarePermission(auth.PermLoginsUnlock, apiCfg.handlerUnlockLogin))
+	mux.Handle("PUT /admin/users/{userID}/roles/{role}", apiCfg.middlewarePermission(auth.PermRolesManage, apiCfg.handlerGrantRole))
+	mux.Handle("DELETE /admin/users/{userID}/roles/{role}", apiCfg.middlewarePermission(auth.PermRolesManage, apiCfg.handlerRevokeRole))
 
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
@@ -58,22 +130,221 @@ func main() {
 
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUserCreation)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
+	mux.HandleFunc("GET /api/users/me/security_events", apiCfg.handlerListSecurityEvents)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerUserLogin)
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.handlerLoginTwoFactor)
+	mux.HandleFunc("GET /api/oidc/{provider}/login", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/oidc/{provider}/callback", apiCfg.handlerOIDCCallback)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerTokenRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerTokenRevoke)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
+
+	mux.HandleFunc("POST /api/users/2fa/totp", apiCfg.handlerBeginTOTP)
+	mux.HandleFunc("GET /api/users/2fa/totp/qr.png", apiCfg.handlerTOTPQRCode)
+	mux.HandleFunc("POST /api/users/2fa/totp/confirm", apiCfg.handlerConfirmTOTP)
+	mux.HandleFunc("POST /api/users/2fa/disable", apiCfg.handlerDisableTwoFactor)
+
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerListSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.handlerRevokeSession)
+	mux.HandleFunc("POST /api/sessions/revoke_all", apiCfg.handlerRevokeAllSessions)
+
+	mux.HandleFunc("POST /api/tokens", apiCfg.handlerCreatePersonalToken)
+	mux.HandleFunc("GET /api/tokens", apiCfg.handlerListPersonalTokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.handlerRevokePersonalToken)
+
+	mux.HandleFunc("POST /api/oauth/apps", apiCfg.handlerCreateOAuthApp)
+	mux.HandleFunc("GET /api/oauth/apps", apiCfg.handlerListOAuthApps)
+	mux.HandleFunc("DELETE /api/oauth/apps/{appID}", apiCfg.handlerDeleteOAuthApp)
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.handlerOAuthAuthorize)
+	mux.HandleFunc("GET /api/oauth/consent", apiCfg.handlerOAuthConsentDetails)
+	mux.HandleFunc("POST /api/oauth/consent", apiCfg.handlerOAuthConsent)
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /api/oauth/revoke", apiCfg.handlerOAuthRevoke)
 
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerRedWebhook)
 
+	mux.HandleFunc("GET /users/{handle}/feed.rss", apiCfg.handlerUserFeed(feed.FormatRSS))
+	mux.HandleFunc("GET /users/{handle}/feed.atom", apiCfg.handlerUserFeed(feed.FormatAtom))
+	mux.HandleFunc("GET /hashtags/{tag}/feed.rss", apiCfg.handlerHashtagFeed(feed.FormatRSS))
+	mux.HandleFunc("GET /hashtags/{tag}/feed.atom", apiCfg.handlerHashtagFeed(feed.FormatAtom))
+
+	mux.HandleFunc("GET /.well-known/webfinger", apiCfg.handlerWebFinger)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+	mux.HandleFunc("GET /users/{handle}", apiCfg.handlerActor)
+	mux.HandleFunc("GET /users/{handle}/outbox", apiCfg.handlerOutbox)
+	mux.HandleFunc("GET /users/{handle}/followers", apiCfg.handlerFollowers)
+	mux.HandleFunc("GET /users/{handle}/chirps/{chirpID}", apiCfg.handlerNote)
+	mux.HandleFunc("POST /users/{handle}/inbox", apiCfg.handlerInbox)
+	mux.HandleFunc("POST /api/follows", apiCfg.handlerFollowRemote)
+
+	mux.HandleFunc("POST /api/graphql", apiCfg.handlerGraphQL)
+
+	mux.HandleFunc("GET /api/openapi.json", handlerOpenAPI)
+	mux.HandleFunc("GET /api/docs", handlerAPIDocs)
+	mux.HandleFunc("GET /api/docs/redoc.standalone.js", handlerAPIDocsScript)
+
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: middlewareClientInfo(mux),
+	}
+
+	err = apiCfg.service.RotateSigningKeys(context.Background())
+	if err != nil {
+		log.Fatalf("Error loading signing keys: %s", err)
+	}
+	go apiCfg.service.RunKeyRotation(context.Background(), 5*time.Minute)
+	go apiCfg.service.RunMaintenance(context.Background(), time.Hour)
+
+	apiCfg.startDeliveryWorkers()
+	events, _ := apiCfg.service.Events().Subscribe()
+	go apiCfg.federateEvents(events)
+
+	listener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatalf("Error listening for gRPC: %s", err)
 	}
+	go func() {
+		log.Printf("Serving gRPC on port: %s\n", grpcPort)
+		log.Fatal(grpcapi.NewServer(apiCfg.service).Serve(listener))
+	}()
 
 	log.Printf("Serving on port: %s\n", port)
 	log.Fatal(srv.ListenAndServe())
 
 }
 
+// Duration from the environment, such as "15m" or "720h"
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Error parsing %s: must be a positive duration such as 15m", name)
+	}
+	return duration
+}
+
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Fatalf("Error parsing %s: must be a positive integer", name)
+	}
+	return n
+}
+
+// Secrets from POLKA_WEBHOOK_SECRETS, comma separated so a new one can be
+// added while Polka still signs with the old one, or POLKA_KEY
+func newPolkaWebhooks() auth.WebhookVerifier {
+	value := os.Getenv("POLKA_WEBHOOK_SECRETS")
+	if value == "" {
+		value = os.Getenv("POLKA_KEY")
+	}
+
+	secrets := auth.WebhookSecrets(value)
+	if len(secrets) == 0 {
+		log.Print("No Polka webhook secret configured, webhooks will be rejected")
+	}
+
+	return auth.WebhookVerifier{
+		Secrets:   secrets,
+		Tolerance: durationEnv("POLKA_SIGNATURE_TOLERANCE", auth.DefaultWebhookTolerance),
+	}
+}
+
+// argon2id unless PASSWORD_HASHER=bcrypt, hashes made by the other one
+// still verify and are replaced on the next login
+func newPasswordHashing() auth.PasswordHashing {
+	argon := auth.Argon2id{
+		Memory:      uint32(intEnv("ARGON2_MEMORY_KIB", int(auth.DefaultArgon2id.Memory))),
+		Time:        uint32(intEnv("ARGON2_TIME", int(auth.DefaultArgon2id.Time))),
+		Parallelism: uint8(intEnv("ARGON2_PARALLELISM", int(auth.DefaultArgon2id.Parallelism))),
+		SaltLength:  auth.DefaultArgon2id.SaltLength,
+		KeyLength:   auth.DefaultArgon2id.KeyLength,
+	}
+	bcrypt := auth.Bcrypt{Cost: intEnv("BCRYPT_COST", 12)}
+
+	switch os.Getenv("PASSWORD_HASHER") {
+	case "", "argon2id":
+		return auth.PasswordHashing{Current: argon, Legacy: []auth.PasswordHasher{bcrypt}}
+	case "bcrypt":
+		return auth.PasswordHashing{Current: bcrypt, Legacy: []auth.PasswordHasher{argon}}
+	default:
+		log.Fatalf("Unknown PASSWORD_HASHER %q, use argon2id or bcrypt", os.Getenv("PASSWORD_HASHER"))
+		return auth.PasswordHashing{}
+	}
+}
+
+// BREACHED_PASSWORDS_FILE is a sorted Pwned Passwords SHA-1 list, new
+// passwords found in it are refused
+func newPasswordPolicy() auth.PasswordPolicy {
+	policy := auth.PasswordPolicy{MinLength: intEnv("PASSWORD_MIN_LENGTH", auth.DefaultPasswordPolicy.MinLength)}
+
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path != "" {
+		breached, err := auth.OpenBreachedPasswords(path)
+		if err != nil {
+			log.Fatalf("Error opening breached passwords: %s", err)
+		}
+		policy.Breached = breached
+	}
+	return policy
+}
+
+// SMTP when MAILER=smtp, otherwise messages are written to MAIL_DIR or the log
+func newMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+
+	if os.Getenv("MAILER") == "smtp" {
+		return &mailer.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+
+	return &mailer.FileMailer{
+		Dir:  os.Getenv("MAIL_DIR"),
+		From: from,
+	}
+}
+
+// Providers named in OIDC_PROVIDERS, each configured by OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET
+func newOIDCProviders(baseURL string) []*oidc.Provider {
+	var providers []*oidc.Provider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/oidc/" + name + "/callback",
+		}))
+	}
+	return providers
+}
+
 func handlerReadiness(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -88,12 +359,13 @@ func (cfg *apiConfig) handlerHitCount(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handlerResetCount(w http.ResponseWriter, r *http.Request) {
+	// Wipes every user and role, so only ever on a development server
 	if cfg.platform != "dev" {
 		w.WriteHeader(403)
 		return
 	}
 
-	err := cfg.queries.DeleteUsers(r.Context())
+	err := cfg.service.DeleteAllUsers(r.Context())
 	if err != nil {
 		log.Printf("Error deleting users: %s", err)
 		w.WriteHeader(500)
@@ -104,6 +376,41 @@ func (cfg *apiConfig) handlerResetCount(w http.ResponseWriter, r *http.Request)
 	return
 }
 
+func handlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(openapi.Spec)
+}
+
+func handlerAPIDocs(w http.ResponseWriter, r *http.Request) {
+	serveDocsFile(w, openapi.DocsPage, "text/html; charset=utf-8")
+}
+
+func handlerAPIDocsScript(w http.ResponseWriter, r *http.Request) {
+	serveDocsFile(w, openapi.DocsScript, "text/javascript; charset=utf-8")
+}
+
+func serveDocsFile(w http.ResponseWriter, name, contentType string) {
+	dat, err := openapi.Docs.ReadFile(name)
+	if err != nil {
+		log.Printf("Error reading %s, run go generate ./internal/openapi: %s", name, err)
+		w.WriteHeader(404)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+// Make the caller's address and user agent available to the audit log
+func middlewareClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := service.WithClient(r.Context(), service.ClientInfo{UserAgent: r.UserAgent(), IP: clientIP(r)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cfg.fileServerHits.Add(1)
@@ -111,17 +418,25 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
-// Validate JWT from Header
-func (cfg *apiConfig) AuthorizeHeader(header http.Header) (userID uuid.UUID, err error) {
-	tokenString, err := auth.GetBearerToken(header)
+// Validate JWT from Header, each handler names the scope it requires of app tokens
+func (cfg *apiConfig) AuthorizeHeader(ctx context.Context, header http.Header, scope string) (userID uuid.UUID, err error) {
+	tokenString, err := bearerToken(header)
 	if err != nil {
-		return
+		return uuid.Nil, err
 	}
 
-	userID, err = auth.ValidateJWT(tokenString, cfg.tokenSecret)
+	return cfg.service.Authenticate(ctx, tokenString, scope)
+}
+
+// Bearer token from the Authorization header, a malformed header is a bad
+// request while a missing one means the caller is not authenticated
+func bearerToken(header http.Header) (string, error) {
+	token, err := auth.GetBearerToken(header)
+	if errors.Is(err, auth.ErrMalformedHeader) {
+		return "", fmt.Errorf("%w: %s", service.ErrInvalid, err)
+	}
 	if err != nil {
-		return
+		return "", fmt.Errorf("%w: %s", service.ErrUnauthorized, err)
 	}
-
-	return
+	return token, nil
 }
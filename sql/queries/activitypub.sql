@@ -0,0 +1,100 @@
+-- name: CreateActorKey :one
+INSERT INTO actor_keys (user_id, created_at, public_key_pem, private_key_pem)
+VALUES (
+	$1,
+	NOW(),
+	$2,
+	$3
+)
+RETURNING *;
+
+-- name: GetActorKey :one
+SELECT * FROM actor_keys
+WHERE user_id = $1;
+
+-- name: UpsertRemoteActor :one
+INSERT INTO remote_actors (id, created_at, updated_at, preferred_username, inbox, shared_inbox, public_key_id, public_key_pem)
+VALUES (
+	$1,
+	NOW(),
+	NOW(),
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+)
+ON CONFLICT (id) DO UPDATE
+SET preferred_username = EXCLUDED.preferred_username,
+	inbox = EXCLUDED.inbox,
+	shared_inbox = EXCLUDED.shared_inbox,
+	public_key_id = EXCLUDED.public_key_id,
+	public_key_pem = EXCLUDED.public_key_pem,
+	updated_at = NOW()
+RETURNING *;
+
+-- name: GetRemoteActor :one
+SELECT * FROM remote_actors
+WHERE id = $1;
+
+-- name: GetRemoteActorByKeyID :one
+SELECT * FROM remote_actors
+WHERE public_key_id = $1;
+
+-- name: DeleteRemoteActor :exec
+DELETE FROM remote_actors
+WHERE id = $1;
+
+-- name: AddFollower :exec
+INSERT INTO followers (user_id, actor_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, actor_id) DO NOTHING;
+
+-- name: RemoveFollower :exec
+DELETE FROM followers
+WHERE user_id = $1 AND actor_id = $2;
+
+-- name: GetFollowerIDs :many
+SELECT actor_id FROM followers
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetFollowerInboxes :many
+SELECT DISTINCT COALESCE(remote_actors.shared_inbox, remote_actors.inbox)::text AS inbox
+FROM followers
+JOIN remote_actors ON followers.actor_id = remote_actors.id
+WHERE followers.user_id = $1;
+
+-- name: CreateFollowing :exec
+INSERT INTO following (user_id, actor_id, created_at, accepted_at)
+VALUES ($1, $2, NOW(), NULL)
+ON CONFLICT (user_id, actor_id) DO NOTHING;
+
+-- name: AcceptFollowing :exec
+UPDATE following
+SET accepted_at = NOW()
+WHERE user_id = $1 AND actor_id = $2;
+
+-- name: DeleteFollowing :exec
+DELETE FROM following
+WHERE user_id = $1 AND actor_id = $2;
+
+-- name: IsActorFollowed :one
+SELECT EXISTS (
+	SELECT 1 FROM following
+	WHERE actor_id = $1 AND accepted_at IS NOT NULL
+);
+
+-- name: CreateRemoteNote :exec
+INSERT INTO remote_notes (id, created_at, actor_id, content, published_at)
+VALUES ($1, NOW(), $2, $3, $4)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteRemoteNote :exec
+DELETE FROM remote_notes
+WHERE id = $1 AND actor_id = $2;
+
+-- name: CountFollowersByUsers :many
+SELECT user_id, COUNT(*) AS follower_count FROM followers
+WHERE user_id = ANY(sqlc.arg(user_ids)::uuid[])
+GROUP BY user_id;
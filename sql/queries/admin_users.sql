@@ -0,0 +1,33 @@
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE (sqlc.arg(search)::text = '' OR email ILIKE '%' || sqlc.arg(search) || '%' OR handle ILIKE '%' || sqlc.arg(search) || '%')
+AND (sqlc.narg(before_created_at)::timestamp IS NULL OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+
+-- name: GetUserActivity :one
+SELECT
+	(SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1) AS chirp_count,
+	(SELECT COUNT(*) FROM followers WHERE followers.user_id = $1) AS follower_count,
+	(SELECT COUNT(*) FROM sessions WHERE sessions.user_id = $1 AND sessions.revoked_at IS NULL) AS active_sessions,
+	(SELECT MAX(sessions.last_used_at) FROM sessions WHERE sessions.user_id = $1)::timestamp AS last_seen_at;
+
+
+-- name: SuspendUser :one
+UPDATE users
+SET suspended_at = NOW(), suspended_until = $2, suspension_reason = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_at = NULL, suspended_until = NULL, suspension_reason = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
@@ -0,0 +1,30 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (id, created_at, event_type, actor_id, target_id, ip, user_agent, metadata)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+);
+
+
+-- name: SearchAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+AND (sqlc.narg(target_id)::uuid IS NULL OR target_id = sqlc.narg(target_id))
+AND (cardinality(sqlc.arg(event_types)::text[]) = 0 OR event_type = ANY(sqlc.arg(event_types)::text[]))
+AND (sqlc.arg(ip)::text = '' OR ip = sqlc.arg(ip))
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+AND (sqlc.narg(before_created_at)::timestamp IS NULL OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+
+-- name: DeleteAuditEventsBefore :execrows
+DELETE FROM audit_events
+WHERE created_at < $1;
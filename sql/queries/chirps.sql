@@ -20,3 +20,26 @@ DELETE FROM chirps WHERE id = $1;
 
 -- name: GetUserChirps :many
 SELECT * FROM chirps WHERE user_id = $1;
+
+-- name: GetRecentUserChirps :many
+SELECT * FROM chirps WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetRecentChirpsByHashtag :many
+SELECT * FROM chirps
+WHERE body ~* ('(^|\s)#' || sqlc.arg(tag)::text || '([^[:alnum:]_]|$)')
+ORDER BY created_at DESC
+LIMIT sqlc.arg(entry_limit);
+
+-- name: GetChirpsPage :many
+SELECT * FROM chirps
+WHERE (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id))
+AND (sqlc.narg(before_created_at)::timestamp IS NULL OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: CountChirpsByUsers :many
+SELECT user_id, COUNT(*) AS chirp_count FROM chirps
+WHERE user_id = ANY(sqlc.arg(user_ids)::uuid[])
+GROUP BY user_id;
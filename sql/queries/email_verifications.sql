@@ -0,0 +1,25 @@
+-- name: CreateEmailVerification :one
+INSERT INTO email_verifications (id, user_id, email, created_at, expires_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	NOW(),
+	$3
+)
+RETURNING *;
+
+
+-- name: UseEmailVerification :one
+UPDATE email_verifications
+SET used_at = NOW()
+WHERE id = $1
+	AND used_at IS NULL
+	AND expires_at > NOW()
+RETURNING *;
+
+
+-- name: GetRecentEmailVerifications :many
+SELECT * FROM email_verifications
+WHERE user_id = $1 AND created_at > $2
+ORDER BY created_at DESC;
@@ -0,0 +1,46 @@
+-- name: CreateIdentity :one
+INSERT INTO identities (id, user_id, provider, subject, email, created_at, last_login_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW(),
+	NOW()
+)
+RETURNING *;
+
+
+-- name: GetIdentity :one
+SELECT * FROM identities
+WHERE provider = $1 AND subject = $2;
+
+
+-- name: TouchIdentity :exec
+UPDATE identities
+SET last_login_at = NOW(), email = $2
+WHERE id = $1;
+
+
+-- name: CreateOidcLogin :one
+INSERT INTO oidc_logins (id, provider, nonce, code_verifier, created_at, expires_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	NOW(),
+	$4
+)
+RETURNING *;
+
+
+-- name: UseOidcLogin :one
+UPDATE oidc_logins
+SET used_at = NOW()
+WHERE id = $1
+	AND provider = $2
+	AND used_at IS NULL
+	AND expires_at > NOW()
+RETURNING *;
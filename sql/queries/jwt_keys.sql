@@ -0,0 +1,27 @@
+-- name: CreateJwtKey :one
+INSERT INTO jwt_keys (id, algorithm, private_key_pem, created_at, activates_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	NOW(),
+	$4
+)
+RETURNING *;
+
+
+-- name: GetUnretiredJwtKeys :many
+SELECT * FROM jwt_keys
+WHERE retires_at IS NULL OR retires_at > NOW()
+ORDER BY activates_at ASC;
+
+
+-- name: RetireJwtKeys :exec
+UPDATE jwt_keys
+SET retires_at = $2
+WHERE retires_at IS NULL AND activates_at < $1;
+
+
+-- name: DeleteRetiredJwtKeys :exec
+DELETE FROM jwt_keys
+WHERE retires_at < $1;
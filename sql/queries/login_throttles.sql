@@ -0,0 +1,31 @@
+-- name: GetActiveLoginLocks :many
+SELECT * FROM login_throttles
+WHERE key = ANY(sqlc.arg(keys)::text[]) AND locked_until > NOW();
+
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+		WHEN login_throttles.last_failure_at < $2 THEN 1
+		ELSE login_throttles.failures + 1
+	END,
+	last_failure_at = NOW()
+RETURNING *;
+
+
+-- name: LockLogin :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE key = $1;
+
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
+
+
+-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
@@ -0,0 +1,53 @@
+-- name: CreateOauthApp :one
+INSERT INTO oauth_apps (id, owner_id, name, redirect_uri, client_secret_hash, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW(),
+	NOW()
+)
+RETURNING *;
+
+
+-- name: GetOauthApp :one
+SELECT * FROM oauth_apps
+WHERE id = $1;
+
+
+-- name: GetUserOauthApps :many
+SELECT * FROM oauth_apps
+WHERE owner_id = $1
+ORDER BY created_at ASC;
+
+
+-- name: DeleteUserOauthApp :execrows
+DELETE FROM oauth_apps
+WHERE id = $1 AND owner_id = $2;
+
+
+-- name: CreateOauthCode :one
+INSERT INTO oauth_codes (id, app_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	NOW(),
+	$6
+)
+RETURNING *;
+
+
+-- name: UseOauthCode :one
+UPDATE oauth_codes
+SET used_at = NOW()
+WHERE id = $1
+	AND app_id = $2
+	AND used_at IS NULL
+	AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,29 @@
+-- name: CreatePasswordReset :one
+INSERT INTO password_resets (id, user_id, created_at, expires_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	NOW(),
+	$2
+)
+RETURNING *;
+
+
+-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = NOW()
+WHERE id = $1
+	AND used_at IS NULL
+	AND expires_at > NOW()
+RETURNING *;
+
+
+-- name: CountRecentPasswordResets :one
+SELECT COUNT(*) FROM password_resets
+WHERE user_id = $1 AND created_at > $2;
+
+
+-- name: ExpireUserPasswordResets :exec
+UPDATE password_resets
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
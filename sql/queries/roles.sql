@@ -0,0 +1,41 @@
+-- name: GetUserRoles :many
+SELECT role FROM user_roles
+WHERE user_id = $1
+ORDER BY role ASC;
+
+
+-- name: RoleExists :one
+SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1);
+
+
+-- name: GrantUserRole :execrows
+INSERT INTO user_roles (user_id, role, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT (user_id, role) DO NOTHING;
+
+
+-- name: RevokeUserRole :execrows
+DELETE FROM user_roles
+WHERE user_id = $1 AND role = $2;
+
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM user_roles
+WHERE role = $1;
+
+
+-- name: CountActiveUsersWithRole :one
+SELECT COUNT(*) FROM user_roles
+JOIN users ON users.id = user_roles.user_id
+WHERE user_roles.role = $1
+	AND (users.suspended_at IS NULL OR users.suspended_until <= NOW());
+
+
+-- name: GetPermissionsForRoles :many
+SELECT DISTINCT permission FROM role_permissions
+WHERE role = ANY(sqlc.arg(roles)::text[])
+ORDER BY permission ASC;
@@ -0,0 +1,63 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, created_at, last_used_at, user_agent, ip, device_name)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	NOW(),
+	NOW(),
+	$2,
+	$3,
+	$4
+)
+RETURNING *;
+
+
+-- name: GetUserSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY last_used_at DESC;
+
+
+-- name: TouchSession :one
+UPDATE sessions
+SET last_used_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL
+RETURNING *;
+
+
+-- name: RevokeSessionByID :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
+
+
+-- name: RevokeUserSession :execrows
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+
+-- name: CreateAppSession :one
+INSERT INTO sessions (id, user_id, created_at, last_used_at, user_agent, ip, app_id, scopes)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	NOW(),
+	NOW(),
+	$2,
+	$3,
+	$4,
+	$5
+)
+RETURNING *;
+
+
+-- name: GetSessionByID :one
+SELECT * FROM sessions
+WHERE id = $1;
@@ -0,0 +1,54 @@
+-- name: GetUserSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+
+-- name: UpsertSubscription :one
+WITH upserted AS (
+	INSERT INTO subscriptions (id, user_id, provider, provider_ref, plan, status, current_period_end, created_at, updated_at, last_event_at)
+	VALUES (
+		gen_random_uuid(),
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6,
+		NOW(),
+		NOW(),
+		$7
+	)
+	ON CONFLICT (user_id) DO UPDATE
+	SET provider = EXCLUDED.provider,
+		provider_ref = EXCLUDED.provider_ref,
+		plan = EXCLUDED.plan,
+		status = EXCLUDED.status,
+		current_period_end = EXCLUDED.current_period_end,
+		updated_at = NOW(),
+		last_event_at = EXCLUDED.last_event_at
+	WHERE subscriptions.last_event_at <= EXCLUDED.last_event_at
+	RETURNING user_id, status
+)
+UPDATE users
+SET is_chirpy_red = upserted.status <> 'expired', updated_at = NOW()
+FROM upserted
+WHERE users.id = upserted.user_id
+RETURNING users.*;
+
+
+-- name: ExpireLapsedSubscriptions :many
+WITH expired AS (
+	UPDATE subscriptions
+	SET status = 'expired', updated_at = NOW()
+	WHERE current_period_end IS NOT NULL
+	AND (
+		(status = 'cancelled' AND current_period_end <= sqlc.arg(now)::timestamp)
+		OR (status IN ('active', 'past_due') AND current_period_end <= sqlc.arg(grace_cutoff)::timestamp)
+	)
+	RETURNING *
+)
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+FROM expired
+WHERE users.id = expired.user_id
+RETURNING expired.*;
@@ -1,13 +1,13 @@
 -- name: CreateToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
 VALUES (
 	$1,
     NOW(),
     NOW(),
     $2,
     $3,
-	NULL
-
+	NULL,
+	$4
 )
 RETURNING *;
 
@@ -19,10 +19,40 @@ SELECT
 	refresh_tokens.expires_at
 FROM refresh_tokens 
 JOIN users ON refresh_tokens.user_id = users.id
-WHERE refresh_tokens.token = $1;
+WHERE refresh_tokens.token_hash = $1;
+
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1;
+
+
+-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
+	AND used_at IS NULL
+	AND revoked_at IS NULL
+	AND expires_at > NOW()
+RETURNING *;
 
 
 -- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)
+	AND revoked_at IS NULL;
+
+
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+	AND revoked_at IS NULL;
+
+
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+	AND revoked_at IS NULL;
@@ -0,0 +1,46 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	NOW()
+);
+
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (id, user_id, created_at, expires_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	NOW(),
+	$2
+)
+RETURNING *;
+
+
+-- name: AttemptLoginChallenge :one
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE id = $1
+	AND used_at IS NULL
+	AND expires_at > NOW()
+	AND attempts < $2
+RETURNING *;
+
+
+-- name: UseLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
 RETURNING *;
 
@@ -18,11 +19,57 @@ WHERE email = $1;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
+SET
+	email = sqlc.arg(email),
+	hashed_password = sqlc.arg(hashed_password),
+	handle = COALESCE(sqlc.narg(handle), handle),
+	updated_at = NOW(),
+	email_verified_at = CASE WHEN email = sqlc.arg(email) THEN email_verified_at END
+WHERE id = sqlc.arg(id)
 RETURNING *;
 
--- name: UpdateUserRedByID :exec
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE handle = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUsersByIDs :many
+SELECT * FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: MarkEmailVerified :one
 UPDATE users
-SET is_chirpy_red = TRUE, updated_at = NOW()
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: SetUserTotpSecret :one
+UPDATE users
+SET totp_secret = $1, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL
+RETURNING *;
+
+-- name: EnableUserTotp :one
+UPDATE users
+SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+RETURNING *;
+
+-- name: DisableUserTotp :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
 WHERE id = $1;
+
+-- name: UseUserTotpStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1);
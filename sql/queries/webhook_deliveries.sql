@@ -0,0 +1,50 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, provider, received_at, headers, body, status)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	NOW(),
+	$2,
+	$3,
+	'received'
+)
+RETURNING *;
+
+
+-- name: FinishWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = $2, verified = $3, event_id = $4, event_type = $5, error = $6, handled_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1;
+
+
+-- name: CountWebhookReplay :exec
+UPDATE webhook_deliveries
+SET replays = replays + 1
+WHERE id = $1;
+
+
+-- name: SearchWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE provider = sqlc.arg(provider)
+AND (sqlc.arg(status)::text = '' OR status = sqlc.arg(status))
+AND (sqlc.arg(event_id)::text = '' OR event_id = sqlc.arg(event_id))
+AND (sqlc.narg(before_received_at)::timestamp IS NULL OR (received_at, id) < (sqlc.narg(before_received_at), sqlc.narg(before_id)::uuid))
+ORDER BY received_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+
+-- name: DeleteWebhookDeliveriesBefore :execrows
+DELETE FROM webhook_deliveries
+WHERE received_at < $1;
+
+
+-- name: DeleteRejectedWebhookDeliveriesBefore :execrows
+DELETE FROM webhook_deliveries
+WHERE status = 'rejected'
+AND received_at < $1;
@@ -0,0 +1,31 @@
+-- name: ClaimWebhookEvent :one
+INSERT INTO webhook_events (provider, event_id, event_type, received_at, claimed_until)
+VALUES ($1, $2, $3, NOW(), NOW() + INTERVAL '5 minutes')
+ON CONFLICT (provider, event_id) DO UPDATE
+SET attempts = webhook_events.attempts + 1, claimed_until = EXCLUDED.claimed_until
+WHERE webhook_events.processed_at IS NULL
+	AND (webhook_events.claimed_until IS NULL OR webhook_events.claimed_until < NOW())
+RETURNING *;
+
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE provider = $1 AND event_id = $2;
+
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events
+SET processed_at = NOW(), claimed_until = NULL
+WHERE provider = $1 AND event_id = $2;
+
+
+-- name: ReleaseWebhookEventClaim :exec
+UPDATE webhook_events
+SET claimed_until = NULL
+WHERE provider = $1 AND event_id = $2 AND processed_at IS NULL;
+
+
+-- name: ReleaseWebhookEvent :exec
+UPDATE webhook_events
+SET processed_at = NULL
+WHERE provider = $1 AND event_id = $2;
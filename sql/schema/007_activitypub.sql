@@ -0,0 +1,48 @@
+-- +goose Up
+CREATE TABLE actor_keys(
+	user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	public_key_pem TEXT NOT NULL,
+	private_key_pem TEXT NOT NULL
+);
+
+CREATE TABLE remote_actors(
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	preferred_username TEXT NOT NULL,
+	inbox TEXT NOT NULL,
+	shared_inbox TEXT,
+	public_key_id TEXT NOT NULL UNIQUE,
+	public_key_pem TEXT NOT NULL
+);
+
+CREATE TABLE followers(
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	actor_id TEXT NOT NULL REFERENCES remote_actors(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, actor_id)
+);
+
+CREATE TABLE following(
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	actor_id TEXT NOT NULL REFERENCES remote_actors(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP DEFAULT NULL,
+	PRIMARY KEY (user_id, actor_id)
+);
+
+CREATE TABLE remote_notes(
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	actor_id TEXT NOT NULL REFERENCES remote_actors(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+	published_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE remote_notes;
+DROP TABLE following;
+DROP TABLE followers;
+DROP TABLE remote_actors;
+DROP TABLE actor_keys;
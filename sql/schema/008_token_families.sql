@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+ADD COLUMN used_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+
+CREATE TABLE security_events(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX security_events_user_id_idx ON security_events(user_id, created_at);
+
+-- +goose Down
+DROP TABLE security_events;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN used_at,
+DROP COLUMN family_id;
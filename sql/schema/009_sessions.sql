@@ -0,0 +1,35 @@
+-- +goose Up
+-- A session is one login, its id is the family id of the refresh tokens rotated from it
+CREATE TABLE sessions(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	device_name TEXT,
+	revoked_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions(user_id);
+
+INSERT INTO sessions (id, user_id, created_at, last_used_at, revoked_at)
+SELECT
+	family_id,
+	user_id,
+	MIN(created_at),
+	MAX(updated_at),
+	CASE WHEN BOOL_AND(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id DROP DEFAULT,
+ADD CONSTRAINT refresh_tokens_family_id_fkey FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT refresh_tokens_family_id_fkey,
+ALTER COLUMN family_id SET DEFAULT gen_random_uuid();
+
+DROP TABLE sessions;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Refresh tokens are stored as hex SHA-256 digests, existing tokens are
+-- converted in place so sessions survive the upgrade
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- Digests cannot be turned back into tokens, so every session is logged out
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
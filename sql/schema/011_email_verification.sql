@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP DEFAULT NULL;
+
+CREATE TABLE email_verifications(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX email_verifications_user_id_idx ON email_verifications(user_id, created_at);
+
+-- +goose Down
+DROP TABLE email_verifications;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
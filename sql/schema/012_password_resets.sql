@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE password_resets(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets(user_id, created_at);
+
+-- +goose Down
+DROP TABLE password_resets;
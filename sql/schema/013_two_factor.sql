@@ -0,0 +1,33 @@
+-- +goose Up
+-- totp_secret is set when enrolment starts and totp_enabled_at once a code confirms it
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT DEFAULT NULL,
+ADD COLUMN totp_enabled_at TIMESTAMP DEFAULT NULL,
+ADD COLUMN totp_last_step BIGINT DEFAULT NULL;
+
+CREATE TABLE recovery_codes(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP DEFAULT NULL,
+	UNIQUE(user_id, code_hash)
+);
+
+CREATE TABLE login_challenges(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	used_at TIMESTAMP DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_last_step,
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_secret;
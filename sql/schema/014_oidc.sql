@@ -0,0 +1,27 @@
+-- +goose Up
+-- Accounts at external OpenID Connect providers linked to local users
+CREATE TABLE identities(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	last_login_at TIMESTAMP NOT NULL,
+	UNIQUE(provider, subject)
+);
+
+-- Pending authorization requests, holding the nonce and PKCE verifier until the callback
+CREATE TABLE oidc_logins(
+	id UUID PRIMARY KEY,
+	provider TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_logins;
+DROP TABLE identities;
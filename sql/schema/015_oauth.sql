@@ -0,0 +1,36 @@
+-- +goose Up
+-- Third-party apps, public apps have no client secret and rely on PKCE alone
+CREATE TABLE oauth_apps(
+	id UUID PRIMARY KEY,
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	redirect_uri TEXT NOT NULL,
+	client_secret_hash TEXT DEFAULT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE oauth_codes(
+	id UUID PRIMARY KEY,
+	app_id UUID NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP DEFAULT NULL
+);
+
+-- A grant to an app is a session limited to its scopes, deleting the app ends it
+ALTER TABLE sessions
+ADD COLUMN app_id UUID REFERENCES oauth_apps(id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE sessions
+DROP COLUMN scopes,
+DROP COLUMN app_id;
+
+DROP TABLE oauth_codes;
+DROP TABLE oauth_apps;
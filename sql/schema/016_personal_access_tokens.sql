@@ -0,0 +1,19 @@
+-- +goose Up
+-- Long-lived tokens for scripts, token_hint keeps the start of the token so users can tell them apart
+CREATE TABLE personal_access_tokens(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	token_hint TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP DEFAULT NULL,
+	last_used_at TIMESTAMP DEFAULT NULL,
+	revoked_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens(user_id);
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Access token signing keys shared by every instance, published ahead of activation and kept until retirement
+CREATE TABLE jwt_keys(
+	id TEXT PRIMARY KEY,
+	algorithm TEXT NOT NULL,
+	private_key_pem TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	activates_at TIMESTAMP NOT NULL,
+	retires_at TIMESTAMP DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE jwt_keys;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Failed login counters per account and per client IP, shared by every instance
+CREATE TABLE login_throttles(
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,49 @@
+-- +goose Up
+CREATE TABLE roles(
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL
+);
+
+CREATE TABLE permissions(
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL
+);
+
+CREATE TABLE role_permissions(
+	role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+	PRIMARY KEY (role, permission)
+);
+
+-- Every user has the user role, only further roles are stored
+CREATE TABLE user_roles(
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+	('user', 'Every account'),
+	('moderator', 'Looks after the community'),
+	('admin', 'Runs the server');
+
+INSERT INTO permissions (name, description) VALUES
+	('metrics:read', 'View server metrics'),
+	('logins:unlock', 'Lift login lockouts'),
+	('roles:manage', 'Grant and revoke roles'),
+	('data:reset', 'Delete every user and chirp');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('moderator', 'metrics:read'),
+	('moderator', 'logins:unlock'),
+	('admin', 'metrics:read'),
+	('admin', 'logins:unlock'),
+	('admin', 'roles:manage'),
+	('admin', 'data:reset');
+
+-- +goose Down
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- A suspension without an end lasts until it is lifted
+ALTER TABLE users
+ADD COLUMN suspended_at TIMESTAMP DEFAULT NULL,
+ADD COLUMN suspended_until TIMESTAMP DEFAULT NULL,
+ADD COLUMN suspension_reason TEXT DEFAULT NULL;
+
+CREATE INDEX users_created_at_idx ON users(created_at, id);
+
+INSERT INTO permissions (name, description) VALUES
+	('users:read', 'List and inspect accounts'),
+	('users:suspend', 'Suspend and unsuspend accounts'),
+	('users:logout', 'Log accounts out everywhere'),
+	('users:chirpy_red', 'Grant and revoke Chirpy Red'),
+	('users:delete', 'Delete accounts and everything they own');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('moderator', 'users:read'),
+	('moderator', 'users:suspend'),
+	('moderator', 'users:logout'),
+	('admin', 'users:read'),
+	('admin', 'users:suspend'),
+	('admin', 'users:logout'),
+	('admin', 'users:chirpy_red'),
+	('admin', 'users:delete');
+
+-- +goose Down
+DELETE FROM permissions
+WHERE name IN ('users:read', 'users:suspend', 'users:logout', 'users:chirpy_red', 'users:delete');
+
+DROP INDEX users_created_at_idx;
+
+ALTER TABLE users
+DROP COLUMN suspension_reason,
+DROP COLUMN suspended_until,
+DROP COLUMN suspended_at;
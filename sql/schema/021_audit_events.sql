@@ -0,0 +1,64 @@
+-- +goose Up
+-- Append-only log of security-relevant events. Actor and target are not
+-- foreign keys so the history of deleted accounts is kept.
+CREATE TABLE audit_events(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	event_type TEXT NOT NULL,
+	actor_id UUID,
+	target_id UUID,
+	ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	metadata JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events(created_at, id);
+CREATE INDEX audit_events_target_id_idx ON audit_events(target_id, created_at);
+CREATE INDEX audit_events_actor_id_idx ON audit_events(actor_id, created_at);
+CREATE INDEX audit_events_event_type_idx ON audit_events(event_type, created_at);
+
+-- Rows are only ever inserted, or deleted once past the retention period
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit events cannot be modified';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO audit_events (id, created_at, event_type, actor_id, target_id, metadata)
+SELECT id, created_at, event_type, user_id, user_id, jsonb_build_object('details', details)
+FROM security_events;
+
+DROP TABLE security_events;
+
+INSERT INTO permissions (name, description) VALUES
+	('audit:read', 'Query the security audit log');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('admin', 'audit:read');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'audit:read';
+
+CREATE TABLE security_events(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX security_events_user_id_idx ON security_events(user_id, created_at);
+
+INSERT INTO security_events (id, created_at, user_id, event_type, details)
+SELECT id, created_at, target_id, event_type, COALESCE(metadata->>'details', metadata::text)
+FROM audit_events
+WHERE target_id IN (SELECT id FROM users);
+
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only;
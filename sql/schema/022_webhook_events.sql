@@ -0,0 +1,15 @@
+-- +goose Up
+-- Deliveries from payment providers by their event ID, so a redelivered
+-- event is acknowledged without being applied twice
+CREATE TABLE webhook_events(
+	provider TEXT NOT NULL,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	received_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 1,
+	processed_at TIMESTAMP DEFAULT NULL,
+	PRIMARY KEY (provider, event_id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- Chirpy Red subscriptions, users.is_chirpy_red is derived from their status
+CREATE TABLE subscriptions(
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	provider_ref TEXT NOT NULL DEFAULT '',
+	plan TEXT NOT NULL,
+	-- active, past_due, cancelled or expired
+	status TEXT NOT NULL,
+	-- NULL for grants without an end
+	current_period_end TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	-- Time of the newest event applied, older deliveries are ignored
+	last_event_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_period_end_idx ON subscriptions(current_period_end) WHERE status <> 'expired';
+
+-- Upgrades from before subscriptions were tracked last until Polka says otherwise
+INSERT INTO subscriptions (id, user_id, provider, plan, status, created_at, updated_at, last_event_at)
+SELECT gen_random_uuid(), id, 'legacy', 'red', 'active', updated_at, updated_at, TIMESTAMP 'epoch'
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
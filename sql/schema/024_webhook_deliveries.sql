@@ -0,0 +1,34 @@
+-- +goose Up
+-- Every webhook request as received, stored before it is acted on so a
+-- delivery that fails part way can be inspected and replayed
+CREATE TABLE webhook_deliveries(
+	id UUID PRIMARY KEY,
+	provider TEXT NOT NULL,
+	received_at TIMESTAMP NOT NULL,
+	headers JSONB NOT NULL,
+	body BYTEA NOT NULL,
+	-- received until handled, then rejected, invalid, processed, duplicate or failed
+	status TEXT NOT NULL,
+	verified BOOLEAN NOT NULL DEFAULT FALSE,
+	event_id TEXT NOT NULL DEFAULT '',
+	event_type TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	handled_at TIMESTAMP,
+	replays INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX webhook_deliveries_received_at_idx ON webhook_deliveries(received_at, id);
+CREATE INDEX webhook_deliveries_event_id_idx ON webhook_deliveries(provider, event_id);
+
+INSERT INTO permissions (name, description) VALUES
+	('webhooks:read', 'Inspect stored webhook deliveries'),
+	('webhooks:replay', 'Replay stored webhook deliveries');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('admin', 'webhooks:read'),
+	('admin', 'webhooks:replay');
+
+-- +goose Down
+DELETE FROM permissions WHERE name IN ('webhooks:read', 'webhooks:replay');
+
+DROP TABLE webhook_deliveries;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Audit events can only be deleted once they are older than the shortest
+-- retention the server allows, MinAuditRetention in the service
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_retained() RETURNS trigger AS $$
+BEGIN
+	IF OLD.created_at > NOW() - INTERVAL '30 days' THEN
+		RAISE EXCEPTION 'audit events are kept for at least 30 days';
+	END IF;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_retained
+BEFORE DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_retained();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TRIGGER audit_events_no_truncate ON audit_events;
+DROP TRIGGER audit_events_retained ON audit_events;
+DROP FUNCTION audit_events_retained;
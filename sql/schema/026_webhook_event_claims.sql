@@ -0,0 +1,7 @@
+-- +goose Up
+-- A delivery holds an event until claimed_until while applying it, so a
+-- concurrent delivery of the same event cannot apply it too
+ALTER TABLE webhook_events ADD COLUMN claimed_until TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE webhook_events DROP COLUMN claimed_until;